@@ -1,18 +1,229 @@
 package api
 
-// CodeSwitchRequest represents the incoming request for code-switching
+// CodeSwitchRequest represents the incoming request for code-switching.
+// Exactly one of Title, Text, HTML and Markdown must be set.
 type CodeSwitchRequest struct {
-	Title          string  `json:"title"`
+	Title          string  `json:"title,omitempty"`
+	Text           string  `json:"text,omitempty"`
+	HTML           string  `json:"html,omitempty"`
+	Markdown       string  `json:"markdown,omitempty"`
 	SourceLanguage string  `json:"sourceLang"`
 	TargetLanguage string  `json:"targetLang"`
 	SwitchPercent  float64 `json:"percentage"`
+	Profile        string  `json:"profile,omitempty"`    // "reader" (default for Title), "full" or "text-only"
+	Standalone     bool    `json:"standalone,omitempty"` // wrap the result in a complete HTML document
+	Output         string  `json:"output,omitempty"`     // "plain" (default), "annotated", "segments", "aligned" or "aligned-table"
+	Glossary       bool    `json:"glossary,omitempty"`   // include a glossary of switched words
+	Tolerance      float64 `json:"tolerance,omitempty"`  // allowed deviation from percentage, in points (default 5)
+
+	// ProtectTerms are names and terms that are never switched. AllowTerms
+	// are words that should not be mistaken for names, such as "May".
+	ProtectTerms []string `json:"protectTerms,omitempty"`
+	AllowTerms   []string `json:"allowTerms,omitempty"`
+
+	// IncludeWords are always switched and ExcludeWords never, including
+	// their inflected forms. PartsOfSpeech limits switching to the given
+	// parts of speech: noun, verb, adj, adv, pron, det, adp, conj, num, part.
+	IncludeWords  []string `json:"includeWords,omitempty"`
+	ExcludeWords  []string `json:"excludeWords,omitempty"`
+	PartsOfSpeech []string `json:"partsOfSpeech,omitempty"`
+
+	// Granularity is "word" (default), "phrase", "clause" or "sentence".
+	// SelectionPolicy picks the clauses or sentences to switch: "easiest"
+	// (default, most frequent words first) or "spread" (evenly distributed,
+	// not allowed with "phrase").
+	Granularity     string `json:"granularity,omitempty"`
+	SelectionPolicy string `json:"selectionPolicy,omitempty"`
+
+	// ContextBefore and ContextAfter are how many neighbouring paragraphs
+	// the model sees as read-only context (default 1 each, 0 for none), along
+	// with the section heading. ContextTokens caps paragraph plus context
+	// (default 2000); context is trimmed first.
+	ContextBefore *int `json:"contextBefore,omitempty"`
+	ContextAfter  *int `json:"contextAfter,omitempty"`
+	ContextTokens int  `json:"contextTokens,omitempty"`
+
+	// BatchTokens is how much paragraph text, in estimated tokens, is sent
+	// to the model in one call (default 1500); negative sends every
+	// paragraph on its own
+	BatchTokens int `json:"batchTokens,omitempty"`
+}
+
+// LevelsRequest asks for a document code-switched at several percentages.
+// SwitchPercent of the embedded request is ignored.
+type LevelsRequest struct {
+	CodeSwitchRequest
+	Levels []float64 `json:"levels"`
+}
+
+// LevelsResponse holds one response per requested percentage, lowest first
+type LevelsResponse struct {
+	Levels []Level `json:"levels"`
+}
+
+// Level is the document code-switched at one percentage
+type Level struct {
+	Percentage float64 `json:"percentage"`
+	CodeSwitchResponse
 }
 
-// CodeSwitchResponse represents the response with the processed article
+// CodeSwitchResponse represents the response with the processed article.
+// The output is returned in the same format as the input: HTML for titles
+// and HTML input, Text or Markdown otherwise.
 type CodeSwitchResponse struct {
-	HTML     string `json:"html"`
-	Title    string `json:"title"`
+	HTML     string `json:"html,omitempty"`
+	Text     string `json:"text,omitempty"`
+	Markdown string `json:"markdown,omitempty"`
+	Format   string `json:"format"`
+	Title    string `json:"title,omitempty"`
 	Language string `json:"language"`
+
+	// Segments holds one segment list per processed paragraph when the
+	// "segments" output mode is requested
+	Segments [][]Segment `json:"segments,omitempty"`
+
+	// Glossary lists the switched words when requested. GlossaryID can be
+	// passed to /glossary/export to download it as CSV or an Anki deck.
+	Glossary   []GlossaryEntry `json:"glossary,omitempty"`
+	GlossaryID string          `json:"glossaryId,omitempty"`
+
+	// Pairs aligns original and switched paragraphs for the "aligned" output
+	Pairs []ParagraphPair `json:"pairs,omitempty"`
+
+	// Achieved reports the share of words actually switched
+	Achieved *Achievement `json:"achieved,omitempty"`
+
+	// Terminology maps every switched word to the translation used for it
+	// across the article. Inconsistencies lists paragraphs where the model
+	// translated a word differently despite that.
+	Terminology     map[string]string   `json:"terminology,omitempty"`
+	Inconsistencies []TermInconsistency `json:"inconsistencies,omitempty"`
+
+	// PromptVersion identifies the prompt templates used
+	PromptVersion string `json:"promptVersion,omitempty"`
+
+	// Usage sums the tokens of every model call made for the request
+	Usage *Usage `json:"usage,omitempty"`
+
+	// Experiments lists the experiment variants the request was assigned
+	// to. RequestID can be passed to /feedback to rate the result.
+	Experiments []ExperimentAssignment `json:"experiments,omitempty"`
+	RequestID   string                 `json:"requestId,omitempty"`
+}
+
+// Usage counts model tokens. Input tokens read from the prompt cache are
+// billed at a fraction of the price, those written to it at a premium;
+// neither is included in InputTokens.
+type Usage struct {
+	InputTokens              int `json:"inputTokens"`
+	OutputTokens             int `json:"outputTokens"`
+	CacheCreationInputTokens int `json:"cacheCreationInputTokens"`
+	CacheReadInputTokens     int `json:"cacheReadInputTokens"`
+}
+
+// ExperimentAssignment is the variant of an experiment a request ran with
+type ExperimentAssignment struct {
+	Experiment string `json:"experiment"`
+	Variant    string `json:"variant"`
+}
+
+// FeedbackRequest is a user's rating of a code-switched result, from 1 to 5
+type FeedbackRequest struct {
+	RequestID string `json:"requestId"`
+	Rating    int    `json:"rating"`
+}
+
+// ExperimentReport holds the aggregated metrics of an experiment's variants
+type ExperimentReport struct {
+	Name     string          `json:"name"`
+	Variants []VariantReport `json:"variants"`
+}
+
+// VariantReport summarizes the requests served by a variant. PassRate is
+// the share of model outputs the output checks accepted, ToleranceRate the
+// share of written back paragraphs within tolerance of the target and
+// MeanError the mean distance in points between the achieved and requested
+// percentage; tokens and latency are per paragraph.
+type VariantReport struct {
+	Name                    string  `json:"name"`
+	Weight                  int     `json:"weight"`
+	Model                   string  `json:"model,omitempty"`
+	PromptVersion           string  `json:"promptVersion,omitempty"`
+	Requests                int     `json:"requests"`
+	Paragraphs              int     `json:"paragraphs"`
+	PassRate                float64 `json:"passRate"`
+	ToleranceRate           float64 `json:"toleranceRate"`
+	MeanError               float64 `json:"meanError"`
+	MeanInputTokens         float64 `json:"meanInputTokens"`
+	MeanOutputTokens        float64 `json:"meanOutputTokens"`
+	MeanCacheCreationTokens float64 `json:"meanCacheCreationTokens"`
+	MeanCacheReadTokens     float64 `json:"meanCacheReadTokens"`
+	MeanLatencyMs           float64 `json:"meanLatencyMs"`
+	Ratings                 int     `json:"ratings"`
+	MeanRating              float64 `json:"meanRating"`
+}
+
+// TermInconsistency is a switched word translated in a paragraph differently
+// from the article's terminology, fixed where the word was first switched
+type TermInconsistency struct {
+	Source         string `json:"source"`
+	Expected       string `json:"expected"`
+	Actual         string `json:"actual"`
+	Paragraph      int    `json:"paragraph"`
+	FirstParagraph int    `json:"firstParagraph"`
+}
+
+// Achievement compares the requested percentage with the share of source
+// words that were switched, for the whole article and per paragraph
+type Achievement struct {
+	Target     float64                `json:"target"`
+	Article    float64                `json:"article"`
+	Paragraphs []ParagraphAchievement `json:"paragraphs"`
+}
+
+// ParagraphAchievement is the planned and achieved switch percentage of a
+// paragraph, identified by its index in the document
+type ParagraphAchievement struct {
+	Index    int     `json:"index"`
+	Planned  float64 `json:"planned"`
+	Achieved float64 `json:"achieved"`
+}
+
+// ParagraphPair is an original paragraph next to its code-switched version,
+// with a token-level diff between the two
+type ParagraphPair struct {
+	Index    int      `json:"index"`
+	Original string   `json:"original"`
+	Switched string   `json:"switched"`
+	Diff     []DiffOp `json:"diff"`
+}
+
+// DiffOp is a run of tokens that is "equal", or was changed by an "insert",
+// "delete" or "substitute"
+type DiffOp struct {
+	Op       string `json:"op"`
+	Original string `json:"original,omitempty"`
+	Text     string `json:"text,omitempty"`
+}
+
+// Segment is a span of code-switched text. Switched spans carry the target
+// language, the source text they replaced and its frequency rank.
+type Segment struct {
+	Text     string `json:"text"`
+	Lang     string `json:"lang"`
+	Original string `json:"original,omitempty"`
+	Rank     int    `json:"rank,omitempty"`
+}
+
+// GlossaryEntry is a source word with the target forms it became, its
+// frequency rank, how often it occurs in the article and an example sentence
+type GlossaryEntry struct {
+	Source  string   `json:"source"`
+	Targets []string `json:"targets"`
+	Rank    int      `json:"rank"`
+	Count   int      `json:"count"`
+	Example string   `json:"example"`
+	Cloze   string   `json:"cloze"`
 }
 
 // Error response for when things go wrong
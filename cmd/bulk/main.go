@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/mrconter1/codeswitch-ai/api"
+	"github.com/mrconter1/codeswitch-ai/internal/experiment"
+	"github.com/mrconter1/codeswitch-ai/internal/frequency"
+	"github.com/mrconter1/codeswitch-ai/internal/gateway"
+	"github.com/mrconter1/codeswitch-ai/internal/processor"
+	"github.com/mrconter1/codeswitch-ai/internal/prompt"
+	"github.com/mrconter1/codeswitch-ai/pkg/cache"
+	"github.com/mrconter1/codeswitch-ai/pkg/claude"
+	"github.com/mrconter1/codeswitch-ai/pkg/claude/fake"
+	"github.com/mrconter1/codeswitch-ai/pkg/lemma"
+	"github.com/mrconter1/codeswitch-ai/pkg/pos"
+)
+
+// line is one line of the output: the response to the request on the same
+// line of the input, or why it failed
+type line struct {
+	Index    int                     `json:"index"`
+	Response *api.CodeSwitchResponse `json:"response,omitempty"`
+	Error    string                  `json:"error,omitempty"`
+}
+
+// Code-switches many articles as one bulk job through the Message Batches
+// API. Requests are read as JSON lines in the format of POST /codeswitch and
+// the responses written as JSON lines in the same order. With -fake the job
+// runs against a local fake of the API that returns every paragraph
+// unchanged, to check the pipeline without an API key.
+func main() {
+	input := flag.String("input", "-", "JSON lines file of code-switch requests, - for stdin")
+	output := flag.String("output", "-", "File to write the JSON lines responses to, - for stdout")
+	poll := flag.Duration("poll", 0, "Interval between checks of the batch status (default 1m, 1s with -fake)")
+	useFake := flag.Bool("fake", false, "Run against a local fake of the API instead of Claude")
+	flag.Parse()
+
+	reqs, err := readRequests(*input)
+	if err != nil {
+		log.Fatalf("Error reading requests: %v", err)
+	}
+
+	claudeClient := claude.New(os.Getenv("CLAUDE_API_KEY"))
+	if *useFake {
+		server := fake.NewServer()
+		defer server.Close()
+		claudeClient = claude.NewWithBaseURL("fake", server.URL())
+		if *poll == 0 {
+			*poll = time.Second
+		}
+		log.Printf("Using a fake API at %s", server.URL())
+	}
+
+	cache, err := cache.New(os.Getenv("REDIS_URL"))
+	if err != nil {
+		log.Fatalf("Failed to initialize cache: %v", err)
+	}
+
+	sources, err := frequency.ConfiguredSources(
+		os.Getenv("FREQUENCY_FILES"),
+		os.Getenv("FREQUENCY_DIR"),
+		os.Getenv("FREQUENCY_URL"))
+	if err != nil {
+		log.Fatalf("Invalid frequency list configuration: %v", err)
+	}
+	frequencies := frequency.NewRegistry(sources...)
+	lemmas := lemma.NewRegistry(os.Getenv("LEMMA_DIR"))
+	taggers := pos.NewRegistry(os.Getenv("POS_DIR"))
+
+	prompts, err := prompt.LoadDir(os.Getenv("PROMPT_DIR"))
+	if err != nil {
+		log.Fatalf("Failed to load prompt templates: %v", err)
+	}
+	experiments, err := experiment.Load(os.Getenv("EXPERIMENTS_FILE"))
+	if err != nil {
+		log.Fatalf("Failed to load experiments: %v", err)
+	}
+
+	processor := processor.New(claudeClient, frequencies, lemmas, taggers, prompts)
+	gateway := gateway.New(cache, processor, experiments)
+
+	// The batch keeps running on the API side when the job is interrupted
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	start := time.Now()
+	// Results are written even when a batch failed, as most may be done
+	results, jobErr := gateway.CodeSwitchBulk(ctx, reqs, *poll)
+
+	out := os.Stdout
+	if *output != "-" {
+		out, err = os.Create(*output)
+		if err != nil {
+			log.Fatalf("Error creating output: %v", err)
+		}
+		defer out.Close()
+	}
+	encoder := json.NewEncoder(out)
+	succeeded := 0
+	for i, result := range results {
+		l := line{Index: i, Response: result.Response}
+		if result.Err != nil {
+			l.Error = result.Err.Error()
+		} else {
+			succeeded++
+		}
+		if err := encoder.Encode(l); err != nil {
+			log.Fatalf("Error writing output: %v", err)
+		}
+	}
+	log.Printf("Bulk job of %d requests finished in %s, %d succeeded", len(reqs), time.Since(start).Round(time.Second), succeeded)
+	if jobErr != nil {
+		log.Fatalf("Bulk job failed: %v", jobErr)
+	}
+}
+
+// readRequests reads one code-switch request per non-empty line
+func readRequests(path string) ([]api.CodeSwitchRequest, error) {
+	var in io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		in = file
+	}
+
+	var reqs []api.CodeSwitchRequest
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var req api.CodeSwitchRequest
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			return nil, err
+		}
+		reqs = append(reqs, req)
+	}
+	return reqs, scanner.Err()
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bufio"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -9,15 +8,16 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
-	"strings"
 	"syscall"
 	"time"
 
 	"github.com/go-redis/redis/v8"
+	"github.com/mrconter1/codeswitch-ai/internal/frequency"
 )
 
 type FrequencyCalculator struct {
 	redisClient *redis.Client
+	frequencies *frequency.Registry
 }
 
 type CalculateRequest struct {
@@ -25,14 +25,14 @@ type CalculateRequest struct {
 	Percentage float64 `json:"percentage"`
 }
 
-func NewFrequencyCalculator(redisURL string) (*FrequencyCalculator, error) {
+func NewFrequencyCalculator(redisURL string, frequencies *frequency.Registry) (*FrequencyCalculator, error) {
 	opt, err := redis.ParseURL(redisURL)
 	if err != nil {
 		return nil, err
 	}
 
 	client := redis.NewClient(opt)
-	return &FrequencyCalculator{redisClient: client}, nil
+	return &FrequencyCalculator{redisClient: client, frequencies: frequencies}, nil
 }
 
 func (fc *FrequencyCalculator) handleCalculate(w http.ResponseWriter, r *http.Request) {
@@ -47,7 +47,7 @@ func (fc *FrequencyCalculator) handleCalculate(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	// Calculate number of words needed based on Zipf's law
+	// Calculate number of words needed from corpus counts
 	words, err := fc.calculateWordsForPercentage(r.Context(), req.Language, req.Percentage)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -74,25 +74,12 @@ func (fc *FrequencyCalculator) calculateWordsForPercentage(ctx context.Context,
 		return nil, err
 	}
 
-	// Calculate how many words we need using Zipf's law
-	totalWords := len(fullList)
-	targetPercentage := percentage / 100.0
-
-	// Simple Zipf implementation
-	total := 0.0
-	for i := 0; i < totalWords; i++ {
-		total += 1.0 / float64(i+1)
-	}
-
-	wordsNeeded := 0
-	cumulative := 0.0
-	for i := 0; i < totalWords; i++ {
-		cumulative += 1.0 / float64(i+1)
-		if cumulative/total >= targetPercentage {
-			wordsNeeded = i + 1
-			break
-		}
+	// Calculate how many words we need from the cumulative corpus counts
+	list, err := fc.frequencies.Get(lang)
+	if err != nil {
+		return nil, err
 	}
+	wordsNeeded := list.Coverage().RankFor(percentage / 100.0)
 
 	result := fullList[:wordsNeeded]
 
@@ -105,47 +92,28 @@ func (fc *FrequencyCalculator) calculateWordsForPercentage(ctx context.Context,
 }
 
 func (fc *FrequencyCalculator) getFullList(ctx context.Context, lang string) ([]string, error) {
-	// Try to get from cache first
-	cacheKey := fmt.Sprintf("wordlist:%s", lang)
-	cached, err := fc.redisClient.Get(ctx, cacheKey).Result()
-	if err == nil {
-		var words []string
-		if err := json.Unmarshal([]byte(cached), &words); err == nil {
-			return words, nil
-		}
-	}
-
-	// Fetch from GitHub if not in cache
-	url := fmt.Sprintf("https://raw.githubusercontent.com/hermitdave/FrequencyWords/master/content/2018/%s/%s_50k.txt", lang, lang)
-	resp, err := http.Get(url)
+	list, err := fc.frequencies.Get(lang)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch word list: %v", err)
-	}
-	defer resp.Body.Close()
-
-	var words []string
-	scanner := bufio.NewScanner(resp.Body)
-	for scanner.Scan() {
-		parts := strings.Fields(scanner.Text())
-		if len(parts) >= 1 {
-			words = append(words, parts[0])
-		}
-	}
-
-	if len(words) == 0 {
-		return nil, fmt.Errorf("no words found for language %s", lang)
+		return nil, err
 	}
 
-	// Cache the result
-	if cached, err := json.Marshal(words); err == nil {
-		fc.redisClient.Set(ctx, cacheKey, cached, 24*time.Hour)
+	words := make([]string, list.Len())
+	for i, wf := range list.Words {
+		words[i] = wf.Word
 	}
-
 	return words, nil
 }
 
 func main() {
-	calculator, err := NewFrequencyCalculator(os.Getenv("REDIS_URL"))
+	sources, err := frequency.ConfiguredSources(
+		os.Getenv("FREQUENCY_FILES"),
+		os.Getenv("FREQUENCY_DIR"),
+		os.Getenv("FREQUENCY_URL"))
+	if err != nil {
+		log.Fatalf("Invalid frequency list configuration: %v", err)
+	}
+
+	calculator, err := NewFrequencyCalculator(os.Getenv("REDIS_URL"), frequency.NewRegistry(sources...))
 	if err != nil {
 		log.Fatalf("Failed to initialize calculator: %v", err)
 	}
@@ -164,6 +132,7 @@ func main() {
 
 	// Setup HTTP server
 	http.HandleFunc("/calculate", calculator.handleCalculate)
+	http.HandleFunc("/coverage", frequency.CoverageHandler(calculator.frequencies))
 
 	server := &http.Server{
 		Addr:    ":8080",
@@ -5,10 +5,15 @@ import (
 	"net/http"
 	"os"
 
+	"github.com/mrconter1/codeswitch-ai/internal/experiment"
+	"github.com/mrconter1/codeswitch-ai/internal/frequency"
 	"github.com/mrconter1/codeswitch-ai/internal/gateway"
 	"github.com/mrconter1/codeswitch-ai/internal/processor"
+	"github.com/mrconter1/codeswitch-ai/internal/prompt"
 	"github.com/mrconter1/codeswitch-ai/pkg/cache"
 	"github.com/mrconter1/codeswitch-ai/pkg/claude"
+	"github.com/mrconter1/codeswitch-ai/pkg/lemma"
+	"github.com/mrconter1/codeswitch-ai/pkg/pos"
 )
 
 func main() {
@@ -21,14 +26,49 @@ func main() {
 		log.Fatalf("Failed to initialize cache: %v", err)
 	}
 
-	// Initialize processor
-	processor := processor.New(claudeClient)
+	// Initialize frequency lists: local files and the embedded lists, with
+	// downloading only when FREQUENCY_URL is set
+	sources, err := frequency.ConfiguredSources(
+		os.Getenv("FREQUENCY_FILES"),
+		os.Getenv("FREQUENCY_DIR"),
+		os.Getenv("FREQUENCY_URL"))
+	if err != nil {
+		log.Fatalf("Invalid frequency list configuration: %v", err)
+	}
+
+	// Initialize processor with frequency lists, lemmatizers and taggers
+	// loaded per source language; LEMMA_DIR and POS_DIR override the bundled
+	// lemma and part-of-speech data
+	frequencies := frequency.NewRegistry(sources...)
+	lemmas := lemma.NewRegistry(os.Getenv("LEMMA_DIR"))
+	taggers := pos.NewRegistry(os.Getenv("POS_DIR"))
+
+	// Prompt templates are bundled unless PROMPT_DIR points to another set
+	prompts, err := prompt.LoadDir(os.Getenv("PROMPT_DIR"))
+	if err != nil {
+		log.Fatalf("Failed to load prompt templates: %v", err)
+	}
+	log.Printf("Using prompt templates %s", prompts.Version())
+
+	processor := processor.New(claudeClient, frequencies, lemmas, taggers, prompts)
+
+	// Prompt and model experiments are read from EXPERIMENTS_FILE
+	experiments, err := experiment.Load(os.Getenv("EXPERIMENTS_FILE"))
+	if err != nil {
+		log.Fatalf("Failed to load experiments: %v", err)
+	}
+	log.Printf("Running %d experiments", len(experiments.Experiments))
 
 	// Initialize gateway
-	gateway := gateway.New(cache, processor)
+	gateway := gateway.New(cache, processor, experiments)
 
 	// Setup routes
 	http.HandleFunc("/codeswitch", gateway.HandleCodeSwitch)
+	http.HandleFunc("/codeswitch/levels", gateway.HandleLevels)
+	http.HandleFunc("/glossary/export", gateway.HandleGlossaryExport)
+	http.HandleFunc("/coverage", frequency.CoverageHandler(frequencies))
+	http.HandleFunc("/feedback", gateway.HandleFeedback)
+	http.HandleFunc("/admin/experiments", gateway.AdminOnly(os.Getenv("ADMIN_TOKEN"), gateway.HandleExperimentReport))
 
 	// Start server
 	log.Printf("Server starting on :8080...")
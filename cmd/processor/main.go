@@ -6,8 +6,13 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
+	"time"
 
+	"github.com/mrconter1/codeswitch-ai/internal/guard"
+	"github.com/mrconter1/codeswitch-ai/internal/processor"
+	"github.com/mrconter1/codeswitch-ai/internal/prompt"
 	"github.com/mrconter1/codeswitch-ai/pkg/claude"
 	"github.com/mrconter1/codeswitch-ai/pkg/messagebroker"
 )
@@ -16,6 +21,12 @@ func main() {
 	// Initialize components
 	claudeClient := claude.New(os.Getenv("CLAUDE_API_KEY"))
 
+	prompts, err := prompt.LoadDir(os.Getenv("PROMPT_DIR"))
+	if err != nil {
+		log.Fatalf("Failed to load prompt templates: %v", err)
+	}
+	log.Printf("Using prompt templates %s", prompts.Version())
+
 	rabbitmq, err := messagebroker.NewRabbitMQ(os.Getenv("RABBITMQ_URL"))
 	if err != nil {
 		log.Fatalf("Failed to connect to RabbitMQ: %v", err)
@@ -33,54 +44,181 @@ func main() {
 		cancel()
 	}()
 
-	// Start consuming tasks
-	tasks, err := rabbitmq.ConsumeParagraphs(ctx)
+	// Start consuming tasks, several at a time so that short paragraphs
+	// share one model call
+	batchSize := envInt("BATCH_SIZE", 8)
+	batches, err := rabbitmq.ConsumeParagraphBatches(ctx, batchSize, 200*time.Millisecond)
 	if err != nil {
 		log.Fatalf("Failed to start consuming: %v", err)
 	}
+	batchTokens := envInt("BATCH_TOKENS", processor.DefaultBatchTokens)
 
 	log.Println("Processor started, waiting for tasks...")
 
 	// Process tasks until context is cancelled
-	for task := range tasks {
-		select {
-		case <-ctx.Done():
-			return
-		default:
-			processedText, err := claudeClient.Complete(ctx, createPrompt(task))
-			if err != nil {
-				log.Printf("Error processing task %s: %v", task.ID, err)
-				continue
+	for tasks := range batches {
+		for _, group := range groupTasks(tasks, batchTokens) {
+			select {
+			case <-ctx.Done():
+				return
+			default:
+				results := processGroup(ctx, claudeClient, prompts, group)
+				for _, resultTask := range results {
+					if err := rabbitmq.PublishParagraph(ctx, resultTask); err != nil {
+						log.Printf("Error publishing result for task %s: %v", resultTask.ID, err)
+						continue
+					}
+					log.Printf("Successfully processed task %s", resultTask.ID)
+				}
 			}
+		}
+	}
+}
 
-			// Publish result back to queue
-			resultTask := messagebroker.ParagraphTask{
-				ID:         task.ID,
-				Text:       processedText,
-				SourceLang: task.SourceLang,
-				TargetLang: task.TargetLang,
+// envInt reads an integer environment variable, or returns def when it is
+// unset or invalid
+func envInt(name string, def int) int {
+	if n, err := strconv.Atoi(os.Getenv(name)); err == nil {
+		return n
+	}
+	return def
+}
+
+// groupTasks splits consumed tasks into groups of the same language pair
+// whose text fits in budget estimated tokens, keeping their order
+func groupTasks(tasks []messagebroker.ParagraphTask, budget int) [][]messagebroker.ParagraphTask {
+	var groups [][]messagebroker.ParagraphTask
+	tokens := 0
+	for _, task := range tasks {
+		size := processor.EstimateTokens(task.Text)
+		if n := len(groups); n > 0 {
+			last := groups[n-1]
+			if tokens+size <= budget && last[0].SourceLang == task.SourceLang && last[0].TargetLang == task.TargetLang {
+				groups[n-1] = append(last, task)
+				tokens += size
+				continue
 			}
+		}
+		groups = append(groups, []messagebroker.ParagraphTask{task})
+		tokens = size
+	}
+	return groups
+}
 
-			if err := rabbitmq.PublishParagraph(ctx, resultTask); err != nil {
-				log.Printf("Error publishing result for task %s: %v", task.ID, err)
+// processGroup code-switches a group of tasks with one call, retrying the
+// tasks the model mangled on their own, and returns the result tasks
+func processGroup(ctx context.Context, claudeClient *claude.Client, prompts *prompt.Set, group []messagebroker.ParagraphTask) []messagebroker.ParagraphTask {
+	var results []messagebroker.ParagraphTask
+	if len(group) > 1 {
+		texts, err := completeBatch(ctx, claudeClient, prompts, group)
+		if err != nil {
+			log.Printf("Error processing batch of %d tasks, processing them one by one: %v", len(group), err)
+		}
+		var retry []messagebroker.ParagraphTask
+		for i, task := range group {
+			if texts == nil || texts[i] == "" {
+				retry = append(retry, task)
 				continue
 			}
+			results = append(results, resultTask(prompts, task, texts[i]))
+		}
+		group = retry
+	}
 
-			log.Printf("Successfully processed task %s", task.ID)
+	for _, task := range group {
+		text, err := processTask(ctx, claudeClient, prompts, task)
+		if err != nil {
+			log.Printf("Error processing task %s: %v", task.ID, err)
+			continue
 		}
+		results = append(results, resultTask(prompts, task, text))
+	}
+	return results
+}
+
+// processTask code-switches a single task
+func processTask(ctx context.Context, claudeClient *claude.Client, prompts *prompt.Set, task messagebroker.ParagraphTask) (string, error) {
+	data := taskData(prompts, task)
+	promptText, err := prompts.Render("task", data)
+	if err != nil {
+		return "", fmt.Errorf("error creating prompt: %v", err)
 	}
+	system, err := prompts.System(data)
+	if err != nil {
+		return "", fmt.Errorf("error creating system prompt: %v", err)
+	}
+	instructions, err := prompts.Instructions("task", data)
+	if err != nil {
+		return "", fmt.Errorf("error creating instructions: %v", err)
+	}
+	completion, err := claudeClient.CompleteWith(ctx, promptText, claude.Options{System: claude.Prefix(system, instructions)})
+	if err != nil {
+		return "", err
+	}
+	if err := guard.Check(task.Text, completion.Text, guard.Options{Percentage: task.Percentage, Nonce: data.Nonce}); err != nil {
+		return "", err
+	}
+	return completion.Text, nil
 }
 
-func createPrompt(task messagebroker.ParagraphTask) string {
-	return fmt.Sprintf(`Translate the following words from %s to %s in this text, maintaining their context and grammar:
+// completeBatch code-switches tasks of one language pair with a batch
+// prompt and returns the text of each, "" for those that were missing or
+// failed the output checks
+func completeBatch(ctx context.Context, claudeClient *claude.Client, prompts *prompt.Set, tasks []messagebroker.ParagraphTask) ([]string, error) {
+	first := tasks[0]
+	batch := prompt.Batch{
+		Nonce:       prompt.NewNonce(),
+		SourceLang:  first.SourceLang,
+		TargetLang:  first.TargetLang,
+		Granularity: "word",
+		Examples:    prompts.Examples(first.SourceLang, first.TargetLang),
+	}
+	for _, task := range tasks {
+		batch.Items = append(batch.Items, taskData(prompts, task))
+	}
+	promptText, opts, err := processor.BatchPrompt(prompts, batch, "")
+	if err != nil {
+		return nil, err
+	}
 
-Text: %s
+	completion, err := claudeClient.CompleteWith(ctx, promptText, opts)
+	if err != nil {
+		return nil, err
+	}
+	texts := prompt.ParseBatch(completion.Text, batch.Nonce, len(tasks))
+	for i, task := range tasks {
+		if texts[i] == "" {
+			continue
+		}
+		if err := guard.Check(task.Text, texts[i], guard.Options{Percentage: task.Percentage, Nonce: batch.Nonce}); err != nil {
+			log.Printf("Batched task %s rejected: %v", task.ID, err)
+			texts[i] = ""
+		}
+	}
+	return texts, nil
+}
 
-Words to translate: %v
+// resultTask is the task published back with the code-switched text
+func resultTask(prompts *prompt.Set, task messagebroker.ParagraphTask, text string) messagebroker.ParagraphTask {
+	return messagebroker.ParagraphTask{
+		ID:         task.ID,
+		Text:       text,
+		SourceLang: task.SourceLang,
+		TargetLang: task.TargetLang,
+		Percentage: task.Percentage,
 
-Please return only the processed text with the translations.`,
-		task.SourceLang,
-		task.TargetLang,
-		task.Text,
-		task.Words)
+		PromptVersion: prompts.Version(),
+	}
+}
+
+// taskData is the prompt data of a task, with the words sent along with it
+func taskData(prompts *prompt.Set, task messagebroker.ParagraphTask) prompt.Data {
+	return prompt.Data{
+		Nonce:      prompt.NewNonce(),
+		SourceLang: task.SourceLang,
+		TargetLang: task.TargetLang,
+		Paragraph:  task.Text,
+		Units:      task.Words,
+		Examples:   prompts.Examples(task.SourceLang, task.TargetLang),
+	}
 }
@@ -19,16 +19,36 @@ func main() {
 	targetLang := flag.String("target", "sv", "Target language")
 	percentage := flag.Float64("percent", 50.0, "Percentage to code-switch")
 	serverURL := flag.String("url", "http://localhost:8080", "CodeSwitch API server URL")
+	input := flag.String("input", "", "File to code-switch instead of a Wikipedia article")
+	format := flag.String("format", "text", "Format of the input file: text, html or markdown")
 	flag.Parse()
 
 	// Create the request
 	req := api.CodeSwitchRequest{
-		Title:          *title,
 		SourceLanguage: *sourceLang,
 		TargetLanguage: *targetLang,
 		SwitchPercent:  *percentage,
 	}
 
+	if *input == "" {
+		req.Title = *title
+	} else {
+		content, err := ioutil.ReadFile(*input)
+		if err != nil {
+			log.Fatalf("Error reading input: %v", err)
+		}
+		switch *format {
+		case "text":
+			req.Text = string(content)
+		case "html":
+			req.HTML = string(content)
+		case "markdown":
+			req.Markdown = string(content)
+		default:
+			log.Fatalf("Unknown format %q", *format)
+		}
+	}
+
 	// Convert request to JSON
 	jsonData, err := json.Marshal(req)
 	if err != nil {
@@ -36,8 +56,12 @@ func main() {
 	}
 
 	// Send request
-	log.Printf("Sending request to process article '%s' (%s → %s, %.1f%%)",
-		req.Title, req.SourceLanguage, req.TargetLanguage, req.SwitchPercent)
+	source := req.Title
+	if *input != "" {
+		source = *input
+	}
+	log.Printf("Sending request to process '%s' (%s → %s, %.1f%%)",
+		source, req.SourceLanguage, req.TargetLanguage, req.SwitchPercent)
 
 	resp, err := http.Post(fmt.Sprintf("%s/codeswitch", *serverURL),
 		"application/json",
@@ -65,5 +89,5 @@ func main() {
 	}
 
 	// Print result
-	fmt.Printf("\nProcessed Article:\n%s\n", result.HTML)
+	fmt.Printf("\nProcessed Article (%s):\n%s\n", result.Format, result.HTML+result.Text+result.Markdown)
 }
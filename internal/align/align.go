@@ -0,0 +1,158 @@
+package align
+
+import (
+	"strings"
+
+	"github.com/mrconter1/codeswitch-ai/pkg/tokenizer"
+)
+
+// Kind classifies an edit between the original and the switched text
+type Kind string
+
+const (
+	Equal      Kind = "equal"
+	Insert     Kind = "insert"
+	Delete     Kind = "delete"
+	Substitute Kind = "substitute"
+)
+
+// Op is a run of tokens that is either unchanged or edited. Original holds
+// the source text of the run and Text the switched text; concatenating Text
+// over all ops reproduces the switched string exactly.
+type Op struct {
+	Kind     Kind
+	Original string
+	Text     string
+}
+
+// token is a word or punctuation mark with the whitespace that follows it
+type token struct {
+	text  string
+	trail string
+}
+
+// tokenize splits s into words, numbers and punctuation, each carrying the
+// whitespace that follows it. Leading whitespace is returned separately
+// since no token precedes it. Words in unspaced scripts are compared
+// character by character.
+func tokenize(s string) (string, []token) {
+	var lead string
+	var tokens []token
+	for _, t := range tokenizer.Tokenize(s) {
+		switch {
+		case tokenizer.IsUnspaced(t):
+			for _, c := range tokenizer.Characters(t) {
+				tokens = append(tokens, token{text: c.Text})
+			}
+		case t.Kind != tokenizer.Space:
+			tokens = append(tokens, token{text: t.Text})
+		case len(tokens) == 0:
+			lead = t.Text
+		default:
+			tokens[len(tokens)-1].trail = t.Text
+		}
+	}
+	return lead, tokens
+}
+
+// Diff aligns the switched text against the original token by token using
+// the longest common subsequence and groups the differences into ops
+func Diff(original, switched string) []Op {
+	_, a := tokenize(original)
+	lead, b := tokenize(switched)
+
+	// lcs[i][j] is the LCS length of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i].text == b[j].text {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var ops []Op
+	if lead != "" {
+		ops = append(ops, Op{Kind: Equal, Text: lead})
+	}
+
+	var deleted, inserted []token
+	flush := func() {
+		if len(deleted) == 0 && len(inserted) == 0 {
+			return
+		}
+		op := Op{Original: join(deleted), Text: join(inserted)}
+		switch {
+		case len(deleted) == 0:
+			op.Kind = Insert
+		case len(inserted) == 0:
+			op.Kind = Delete
+		default:
+			op.Kind = Substitute
+		}
+		ops = append(ops, op)
+		// The whitespace after the last inserted token is not part of the edit
+		if len(inserted) > 0 {
+			if trail := inserted[len(inserted)-1].trail; trail != "" {
+				ops = append(ops, Op{Kind: Equal, Original: trail, Text: trail})
+			}
+		}
+		deleted, inserted = nil, nil
+	}
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i].text == b[j].text:
+			flush()
+			ops = appendEqual(ops, a[i].text+a[i].trail, b[j].text+b[j].trail)
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] >= lcs[i+1][j]):
+			inserted = append(inserted, b[j])
+			j++
+		default:
+			deleted = append(deleted, a[i])
+			i++
+		}
+	}
+	flush()
+
+	return ops
+}
+
+// appendEqual extends a trailing equal op instead of starting a new one
+func appendEqual(ops []Op, original, text string) []Op {
+	if n := len(ops); n > 0 && ops[n-1].Kind == Equal {
+		ops[n-1].Original += original
+		ops[n-1].Text += text
+		return ops
+	}
+	return append(ops, Op{Kind: Equal, Original: original, Text: text})
+}
+
+// join concatenates tokens without the whitespace after the last one
+func join(tokens []token) string {
+	var b strings.Builder
+	for i, t := range tokens {
+		b.WriteString(t.text)
+		if i < len(tokens)-1 {
+			b.WriteString(t.trail)
+		}
+	}
+	return b.String()
+}
+
+// Words returns the word tokens of s, ignoring numbers and punctuation
+func Words(s string) []string {
+	var words []string
+	for _, t := range tokenizer.Words(s) {
+		words = append(words, t.Text)
+	}
+	return words
+}
@@ -0,0 +1,250 @@
+package cleaner
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Profile selects which parts of a Wikipedia article survive cleaning
+type Profile string
+
+const (
+	// ProfileReader strips editing and navigation chrome but keeps infoboxes and media
+	ProfileReader Profile = "reader"
+	// ProfileFull keeps the article as returned by Wikipedia
+	ProfileFull Profile = "full"
+	// ProfileTextOnly keeps headings, paragraphs and lists and nothing else
+	ProfileTextOnly Profile = "text-only"
+)
+
+// DefaultBaseURL is used to absolutize links when no base URL is given
+const DefaultBaseURL = "https://en.wikipedia.org"
+
+// Options controls a cleaning pass
+type Options struct {
+	Profile Profile
+	BaseURL string
+}
+
+// category is a kind of article chrome that a profile may remove
+type category int
+
+const (
+	editLinks category = iota
+	references
+	navigation
+	infoboxes
+	coordinates
+	maintenance
+	media
+)
+
+// removals lists the categories each profile strips from the document
+var removals = map[Profile][]category{
+	ProfileFull:     {},
+	ProfileReader:   {editLinks, references, navigation, coordinates, maintenance},
+	ProfileTextOnly: {editLinks, references, navigation, infoboxes, coordinates, maintenance, media},
+}
+
+// textOnlyElements are the elements kept as markup by the text-only profile.
+// Every other element is replaced by its children.
+var textOnlyElements = map[string]bool{
+	"html": true, "head": true, "body": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"p": true, "ul": true, "ol": true, "li": true, "dl": true, "dt": true, "dd": true,
+	"blockquote": true,
+}
+
+// ParseProfile validates a profile name, defaulting to ProfileFull when empty
+func ParseProfile(name string) (Profile, error) {
+	if name == "" {
+		return ProfileFull, nil
+	}
+	profile := Profile(name)
+	if _, ok := removals[profile]; !ok {
+		return "", fmt.Errorf("unknown profile %q", name)
+	}
+	return profile, nil
+}
+
+// Clean removes article chrome from doc according to the profile and
+// rewrites relative links so they point at the wiki
+func Clean(doc *html.Node, opts Options) error {
+	categories, ok := removals[opts.Profile]
+	if !ok {
+		return fmt.Errorf("unknown profile %q", opts.Profile)
+	}
+
+	baseURL := opts.BaseURL
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return fmt.Errorf("invalid base URL: %v", err)
+	}
+
+	if opts.Profile != ProfileFull {
+		removeComments(doc)
+	}
+	removeMatching(doc, categories)
+	if opts.Profile == ProfileTextOnly {
+		unwrapInline(doc)
+	}
+	rewriteLinks(doc, base)
+
+	return nil
+}
+
+func removeComments(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == html.CommentNode {
+			n.RemoveChild(c)
+		} else {
+			removeComments(c)
+		}
+		c = next
+	}
+}
+
+func removeMatching(n *html.Node, categories []category) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == html.ElementNode && matchesAny(c, categories) {
+			n.RemoveChild(c)
+		} else {
+			removeMatching(c, categories)
+		}
+		c = next
+	}
+}
+
+func matchesAny(n *html.Node, categories []category) bool {
+	for _, cat := range categories {
+		if matches(n, cat) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether an element belongs to a category, based on the
+// class names and ids used by MediaWiki's parser output
+func matches(n *html.Node, cat category) bool {
+	switch cat {
+	case editLinks:
+		return hasClass(n, "mw-editsection")
+	case references:
+		return hasClass(n, "reference") || hasClass(n, "references") ||
+			hasClass(n, "reflist") || hasClass(n, "mw-references-wrap") ||
+			hasClass(n, "mw-cite-backlink") || hasClass(n, "Inline-Template")
+	case navigation:
+		return hasClass(n, "navbox") || hasClass(n, "navbox-styles") ||
+			hasClass(n, "vertical-navbox") || hasClass(n, "sidebar") ||
+			hasClass(n, "toc") || attr(n, "role") == "navigation"
+	case infoboxes:
+		return hasClass(n, "infobox")
+	case coordinates:
+		return attr(n, "id") == "coordinates" || hasClass(n, "geo-default") ||
+			hasClass(n, "geo-nondefault") || hasClass(n, "geo-inline")
+	case maintenance:
+		return n.Data == "style" || n.Data == "script" || n.Data == "link" ||
+			hasClass(n, "ambox") || hasClass(n, "metadata") ||
+			hasClass(n, "mw-empty-elt") || hasClass(n, "noprint") ||
+			isHidden(n)
+	case media:
+		switch n.Data {
+		case "img", "figure", "table", "audio", "video", "math":
+			return true
+		}
+		return hasClass(n, "thumb") || hasClass(n, "gallery") || hasClass(n, "mwe-math-element")
+	}
+	return false
+}
+
+// unwrapInline replaces every element outside textOnlyElements by its children
+func unwrapInline(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		unwrapInline(c)
+		if c.Type == html.ElementNode && !textOnlyElements[c.Data] {
+			for gc := c.FirstChild; gc != nil; {
+				gnext := gc.NextSibling
+				c.RemoveChild(gc)
+				n.InsertBefore(gc, c)
+				gc = gnext
+			}
+			n.RemoveChild(c)
+		}
+		c = next
+	}
+}
+
+// rewriteLinks makes href and src attributes absolute relative to base
+func rewriteLinks(n *html.Node, base *url.URL) {
+	if n.Type == html.ElementNode {
+		for i, a := range n.Attr {
+			switch a.Key {
+			case "href", "src":
+				n.Attr[i].Val = absolute(base, a.Val)
+			case "srcset":
+				n.Attr[i].Val = absoluteSrcset(base, a.Val)
+			}
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		rewriteLinks(c, base)
+	}
+}
+
+func absolute(base *url.URL, ref string) string {
+	if ref == "" || strings.HasPrefix(ref, "#") {
+		return ref
+	}
+	u, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return base.ResolveReference(u).String()
+}
+
+// absoluteSrcset rewrites each candidate of a srcset attribute ("url 1.5x, url 2x")
+func absoluteSrcset(base *url.URL, srcset string) string {
+	candidates := strings.Split(srcset, ",")
+	for i, candidate := range candidates {
+		parts := strings.Fields(candidate)
+		if len(parts) == 0 {
+			continue
+		}
+		parts[0] = absolute(base, parts[0])
+		candidates[i] = strings.Join(parts, " ")
+	}
+	return strings.Join(candidates, ", ")
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasClass(n *html.Node, class string) bool {
+	for _, c := range strings.Fields(attr(n, "class")) {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+func isHidden(n *html.Node) bool {
+	style := strings.ReplaceAll(strings.ToLower(attr(n, "style")), " ", "")
+	return strings.Contains(style, "display:none")
+}
@@ -0,0 +1,49 @@
+package cleaner
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/mrconter1/codeswitch-ai/internal/frequency"
+)
+
+// stylesheet is the minimal CSS embedded in standalone documents
+const stylesheet = `body{margin:0;background:#fdfdfd;color:#202122}
+article{max-width:42em;margin:2em auto;padding:0 1em;font:1.05em/1.6 Georgia,serif}
+h1,h2,h3,h4{font-family:system-ui,sans-serif;line-height:1.25}
+a{color:#3366cc;text-decoration:none}
+img{max-width:100%;height:auto}
+table{border-collapse:collapse;font-size:.9em}
+td,th{border:1px solid #c8ccd1;padding:.2em .4em}
+.infobox{float:right;margin:0 0 1em 1em;max-width:22em}`
+
+// Standalone wraps rendered body markup in a complete HTML document. The
+// document takes the language and direction of the main text; switched
+// spans carry their own lang and dir attributes.
+func Standalone(title string, lang frequency.Language, body string) string {
+	return fmt.Sprintf(`<!DOCTYPE html>
+<html lang="%s" dir="%s">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>%s</title>
+<style>
+%s
+</style>
+</head>
+<body>
+<article>
+<h1>%s</h1>
+%s
+</article>
+</body>
+</html>
+`,
+		html.EscapeString(strings.ReplaceAll(lang.Code, "_", "-")),
+		lang.Direction,
+		html.EscapeString(title),
+		stylesheet,
+		html.EscapeString(title),
+		body)
+}
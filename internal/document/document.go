@@ -0,0 +1,75 @@
+package document
+
+import "strings"
+
+// Format identifies how a document was submitted and how it is rendered back
+type Format string
+
+const (
+	FormatHTML     Format = "html"
+	FormatText     Format = "text"
+	FormatMarkdown Format = "markdown"
+)
+
+// Paragraph is a unit of prose handed to the processor. Text is plain text
+// with any markup that must survive processing masked out. Anchors are the
+// texts of links within the paragraph, and Heading the text of the section
+// heading it falls under.
+type Paragraph struct {
+	Text          string
+	Anchors       []string
+	Heading       string
+	replace       func(string) error
+	replaceMarkup func(string) error
+}
+
+// SplitPlaceholders splits text into the placeholders of masked markup and
+// the runs of text between them, in order and without empty runs
+func SplitPlaceholders(text string) []string {
+	var parts []string
+	last := 0
+	for _, loc := range placeholder.FindAllStringIndex(text, -1) {
+		if loc[0] > last {
+			parts = append(parts, text[last:loc[0]])
+		}
+		parts = append(parts, text[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	if last < len(text) {
+		parts = append(parts, text[last:])
+	}
+	return parts
+}
+
+// IsPlaceholder reports whether s is the placeholder of masked markup
+func IsPlaceholder(s string) bool {
+	return strings.HasPrefix(s, "⟦") && placeholder.FindString(s) == s
+}
+
+// StripPlaceholders removes the placeholders of masked markup, for output
+// that shows the text of a paragraph without its markup
+func StripPlaceholders(text string) string {
+	return placeholder.ReplaceAllString(text, "")
+}
+
+// Replace writes processed text back into the document
+func (p *Paragraph) Replace(text string) error {
+	return p.replace(text)
+}
+
+// ReplaceMarkup writes processed text containing inline HTML back into the
+// document. HTML documents parse the markup into nodes; text and Markdown
+// documents embed it as is.
+func (p *Paragraph) ReplaceMarkup(markup string) error {
+	if p.replaceMarkup == nil {
+		return p.replace(markup)
+	}
+	return p.replaceMarkup(markup)
+}
+
+// Document is a parsed input whose paragraphs can be code-switched in place
+type Document interface {
+	Format() Format
+	Paragraphs() []*Paragraph
+	Render() (string, error)
+}
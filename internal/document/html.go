@@ -0,0 +1,228 @@
+package document
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// HTMLDocument is a parsed HTML page. Root may be modified (for example by the
+// cleaner) until Paragraphs is first called.
+type HTMLDocument struct {
+	Root       *html.Node
+	paragraphs []*Paragraph
+}
+
+// ParseHTML parses an HTML page or fragment
+func ParseHTML(content string) (*HTMLDocument, error) {
+	root, err := html.Parse(strings.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	return &HTMLDocument{Root: root}, nil
+}
+
+func (d *HTMLDocument) Format() Format {
+	return FormatHTML
+}
+
+// Paragraphs returns one paragraph per <p> element. Inline markup is masked
+// with placeholders, so links, emphasis and references survive processing.
+func (d *HTMLDocument) Paragraphs() []*Paragraph {
+	if d.paragraphs != nil {
+		return d.paragraphs
+	}
+
+	headings := paragraphHeadings(d.Root)
+	for _, n := range findParagraphs(d.Root) {
+		node := n
+		text, masked := maskHTML(node)
+		d.paragraphs = append(d.paragraphs, &Paragraph{
+			Text:    text,
+			Anchors: anchorTexts(node),
+			Heading: headings[node],
+			replace: func(text string) error {
+				return setInner(node, html.EscapeString(text), masked)
+			},
+			replaceMarkup: func(markup string) error {
+				return setInner(node, markup, masked)
+			},
+		})
+	}
+	return d.paragraphs
+}
+
+// Render renders the whole tree
+func (d *HTMLDocument) Render() (string, error) {
+	var b strings.Builder
+	if err := html.Render(&b, d.Root); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// RenderBody renders only the contents of the <body> element
+func (d *HTMLDocument) RenderBody() (string, error) {
+	body := findElement(d.Root, "body")
+	if body == nil {
+		body = d.Root
+	}
+
+	var b strings.Builder
+	for c := body.FirstChild; c != nil; c = c.NextSibling {
+		if err := html.Render(&b, c); err != nil {
+			return "", err
+		}
+	}
+	return b.String(), nil
+}
+
+// proseElements are inline elements whose text is processed along with the
+// paragraph; only their tags are masked. Any other element, such as a
+// reference, code or an image, is masked as a whole.
+var proseElements = map[string]bool{
+	"a": true, "abbr": true, "b": true, "bdi": true, "cite": true, "dfn": true,
+	"em": true, "i": true, "mark": true, "q": true, "s": true, "small": true,
+	"span": true, "strong": true, "u": true,
+}
+
+// maskHTML returns the text of a paragraph element with its inline markup
+// replaced by numbered placeholders, and the masked markup
+func maskHTML(n *html.Node) (string, []string) {
+	var b strings.Builder
+	var masked []string
+	mask := func(markup string) {
+		fmt.Fprintf(&b, "⟦%d⟧", len(masked))
+		masked = append(masked, markup)
+	}
+
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			switch {
+			case c.Type == html.TextNode:
+				b.WriteString(c.Data)
+			case c.Type == html.ElementNode && proseElements[c.Data]:
+				mask(openTag(c))
+				walk(c)
+				mask("</" + c.Data + ">")
+			case c.Type == html.ElementNode:
+				var element strings.Builder
+				if html.Render(&element, c) == nil {
+					mask(element.String())
+				}
+			}
+		}
+	}
+	walk(n)
+	return b.String(), masked
+}
+
+// openTag renders the start tag of an element
+func openTag(n *html.Node) string {
+	var b strings.Builder
+	b.WriteString("<" + n.Data)
+	for _, attr := range n.Attr {
+		name := attr.Key
+		if attr.Namespace != "" {
+			name = attr.Namespace + ":" + name
+		}
+		fmt.Fprintf(&b, ` %s="%s"`, name, html.EscapeString(attr.Val))
+	}
+	b.WriteString(">")
+	return b.String()
+}
+
+// setInner restores the masked markup of processed paragraph markup and
+// replaces the children of n with it, failing when placeholders were lost
+func setInner(n *html.Node, markup string, masked []string) error {
+	markup, err := unmaskInline(markup, masked)
+	if err != nil {
+		return err
+	}
+	nodes, err := html.ParseFragment(strings.NewReader(markup), n)
+	if err != nil {
+		return err
+	}
+	for c := n.FirstChild; c != nil; c = n.FirstChild {
+		n.RemoveChild(c)
+	}
+	for _, c := range nodes {
+		n.AppendChild(c)
+	}
+	return nil
+}
+
+func extractTextFromNode(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var result string
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		result += extractTextFromNode(c)
+	}
+	return result
+}
+
+// anchorTexts returns the text of every link below n
+func anchorTexts(n *html.Node) []string {
+	var anchors []string
+	if n.Type == html.ElementNode && n.Data == "a" {
+		if text := strings.TrimSpace(extractTextFromNode(n)); text != "" {
+			anchors = append(anchors, text)
+		}
+		return anchors
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		anchors = append(anchors, anchorTexts(c)...)
+	}
+	return anchors
+}
+
+// paragraphHeadings maps every <p> element to the text of the last heading
+// before it in document order
+func paragraphHeadings(root *html.Node) map[*html.Node]string {
+	headings := make(map[*html.Node]string)
+	var current string
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.Data {
+			case "h1", "h2", "h3", "h4", "h5", "h6":
+				current = strings.Join(strings.Fields(extractTextFromNode(n)), " ")
+				return
+			case "p":
+				headings[n] = current
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(root)
+	return headings
+}
+
+func findParagraphs(n *html.Node) []*html.Node {
+	var paragraphs []*html.Node
+	if n.Type == html.ElementNode && n.Data == "p" {
+		paragraphs = append(paragraphs, n)
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		paragraphs = append(paragraphs, findParagraphs(c)...)
+	}
+	return paragraphs
+}
+
+func findElement(n *html.Node, tag string) *html.Node {
+	if n.Type == html.ElementNode && n.Data == tag {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findElement(c, tag); found != nil {
+			return found
+		}
+	}
+	return nil
+}
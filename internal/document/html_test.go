@@ -0,0 +1,47 @@
+package document
+
+import (
+	"strings"
+	"testing"
+)
+
+const inlineHTML = `<p>The <a href="/wiki/Cat">cat</a> sat on the <b>mat</b>.</p>`
+
+func TestHTMLParagraphsMaskInlineMarkup(t *testing.T) {
+	doc, err := ParseHTML(inlineHTML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := doc.Paragraphs()[0]
+	if want := "The ⟦0⟧cat⟦1⟧ sat on the ⟦2⟧mat⟦3⟧."; p.Text != want {
+		t.Fatalf("Text = %q, want %q", p.Text, want)
+	}
+	if got, want := StripPlaceholders(p.Text), "The cat sat on the mat."; got != want {
+		t.Errorf("StripPlaceholders = %q, want %q", got, want)
+	}
+
+	if err := p.Replace("The ⟦0⟧katt⟦1⟧ sat on the ⟦2⟧matta⟦3⟧."); err != nil {
+		t.Fatal(err)
+	}
+	rendered, err := doc.RenderBody()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `<p>The <a href="/wiki/Cat">katt</a> sat on the <b>matta</b>.</p>`; rendered != want {
+		t.Errorf("rendered %s, want %s", rendered, want)
+	}
+
+	if err := p.Replace("The katt sat on the ⟦2⟧matta⟦3⟧."); err == nil {
+		t.Error("Replace without the placeholders of the link succeeded")
+	}
+}
+
+func TestSplitPlaceholders(t *testing.T) {
+	parts := SplitPlaceholders("⟦0⟧katt⟦1⟧ sat")
+	if got, want := strings.Join(parts, "|"), "⟦0⟧|katt|⟦1⟧| sat"; got != want {
+		t.Errorf("SplitPlaceholders = %q, want %q", got, want)
+	}
+	if !IsPlaceholder("⟦12⟧") || IsPlaceholder("⟦1⟧ ") || IsPlaceholder("katt") {
+		t.Error("IsPlaceholder misclassifies")
+	}
+}
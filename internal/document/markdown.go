@@ -0,0 +1,249 @@
+package document
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	mdHeading   = regexp.MustCompile(`^ {0,3}#{1,6}(\s|$)`)
+	mdFence     = regexp.MustCompile("^ {0,3}(```|~~~)")
+	mdRule      = regexp.MustCompile(`^ {0,3}((\*\s*){3,}|(-\s*){3,}|(_\s*){3,})$`)
+	mdListItem  = regexp.MustCompile(`^(\s*(?:[-*+]|\d{1,9}[.)])\s+)(.*)$`)
+	mdQuote     = regexp.MustCompile(`^(\s*>\s?)(.*)$`)
+	mdVerbatim  = regexp.MustCompile(`^(\s*<|\s*\||    |\t)`)
+	mdLink      = regexp.MustCompile(`(!?)\[([^\]]*)\](\([^)]*\)|\[[^\]]*\])`)
+	mdAutolink  = regexp.MustCompile(`<[a-zA-Z][a-zA-Z0-9+.-]*:[^>\s]*>`)
+	mdInline    = regexp.MustCompile(`</?[a-zA-Z][^<>]*>|<!--.*?-->`)
+	placeholder = regexp.MustCompile(`⟦\d+⟧`)
+)
+
+// markdownBlock is either verbatim markup or a prose block whose text is
+// processed. Prose blocks keep their line prefix (list marker, quote marker)
+// and the inline markup that was masked out of their text.
+type markdownBlock struct {
+	verbatim string
+	prose    bool
+	prefix   string
+	text     string
+	masked   []string
+}
+
+// MarkdownDocument is a Markdown text whose paragraphs, list items and block
+// quotes are processed while headings, code blocks, tables and raw HTML pass
+// through unchanged. Code spans, link targets and inline HTML inside prose
+// are masked with placeholders so they survive processing; any other angle
+// bracket in processed text is escaped, so processing cannot add markup.
+type MarkdownDocument struct {
+	blocks     []*markdownBlock
+	paragraphs []*Paragraph
+	heading    string
+}
+
+// ParseMarkdown splits Markdown into blocks
+func ParseMarkdown(content string) *MarkdownDocument {
+	d := &MarkdownDocument{}
+	lines := strings.Split(content, "\n")
+
+	for i := 0; i < len(lines); {
+		line := lines[i]
+
+		switch {
+		case strings.TrimSpace(line) == "":
+			d.addVerbatim(line)
+			i++
+
+		case mdFence.MatchString(line):
+			fence := strings.TrimSpace(line)[:3]
+			end := i + 1
+			for end < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[end]), fence) {
+				end++
+			}
+			end = min(end+1, len(lines))
+			d.addVerbatim(strings.Join(lines[i:end], "\n"))
+			i = end
+
+		case mdHeading.MatchString(line):
+			d.heading = strings.Trim(strings.TrimSpace(line), "# ")
+			d.addVerbatim(line)
+			i++
+
+		case mdRule.MatchString(line), mdVerbatim.MatchString(line):
+			d.addVerbatim(line)
+			i++
+
+		case mdListItem.MatchString(line):
+			m := mdListItem.FindStringSubmatch(line)
+			end := continuation(lines, i+1)
+			d.addProse(m[1], m[2], lines[i+1:end])
+			i = end
+
+		case mdQuote.MatchString(line):
+			m := mdQuote.FindStringSubmatch(line)
+			parts := []string{m[2]}
+			end := i + 1
+			for end < len(lines) && mdQuote.MatchString(lines[end]) {
+				next := mdQuote.FindStringSubmatch(lines[end])[2]
+				if strings.TrimSpace(next) == "" {
+					break
+				}
+				parts = append(parts, next)
+				end++
+			}
+			d.addProse(m[1], parts[0], parts[1:])
+			i = end
+
+		default:
+			end := continuation(lines, i+1)
+			d.addProse("", line, lines[i+1:end])
+			i = end
+		}
+	}
+
+	return d
+}
+
+// continuation returns the index after the last line that continues the
+// block started on the line before start
+func continuation(lines []string, start int) int {
+	end := start
+	for end < len(lines) {
+		line := lines[end]
+		if strings.TrimSpace(line) == "" || mdHeading.MatchString(line) || mdFence.MatchString(line) ||
+			mdRule.MatchString(line) || mdListItem.MatchString(line) || mdQuote.MatchString(line) {
+			break
+		}
+		end++
+	}
+	return end
+}
+
+func (d *MarkdownDocument) addVerbatim(markup string) {
+	d.blocks = append(d.blocks, &markdownBlock{verbatim: markup})
+}
+
+func (d *MarkdownDocument) addProse(prefix, first string, rest []string) {
+	parts := []string{strings.TrimSpace(first)}
+	for _, line := range rest {
+		parts = append(parts, strings.TrimSpace(line))
+	}
+
+	block := &markdownBlock{prose: true, prefix: prefix}
+	block.text, block.masked = maskInline(strings.Join(parts, " "))
+	d.blocks = append(d.blocks, block)
+
+	var anchors []string
+	for _, m := range mdLink.FindAllStringSubmatch(strings.Join(parts, " "), -1) {
+		if text := strings.TrimSpace(m[2]); m[1] == "" && text != "" {
+			anchors = append(anchors, text)
+		}
+	}
+
+	d.paragraphs = append(d.paragraphs, &Paragraph{
+		Text:    block.text,
+		Anchors: anchors,
+		Heading: d.heading,
+		replace: func(text string) error {
+			return block.replace(strings.ReplaceAll(text, "<", "&lt;"))
+		},
+		replaceMarkup: block.replace,
+	})
+}
+
+// replace sets the processed text of a prose block, failing when the
+// placeholders of masked markup were lost
+func (b *markdownBlock) replace(text string) error {
+	if _, err := unmaskInline(text, b.masked); err != nil {
+		return err
+	}
+	b.text = text
+	return nil
+}
+
+func (d *MarkdownDocument) Format() Format {
+	return FormatMarkdown
+}
+
+func (d *MarkdownDocument) Paragraphs() []*Paragraph {
+	return d.paragraphs
+}
+
+func (d *MarkdownDocument) Render() (string, error) {
+	lines := make([]string, 0, len(d.blocks))
+	for _, block := range d.blocks {
+		if !block.prose {
+			lines = append(lines, block.verbatim)
+			continue
+		}
+		text, err := unmaskInline(block.text, block.masked)
+		if err != nil {
+			return "", err
+		}
+		lines = append(lines, block.prefix+text)
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// maskInline replaces code spans, autolinks, inline HTML, images and link
+// syntax with numbered placeholders. Link text stays in place so it can be
+// processed.
+func maskInline(text string) (string, []string) {
+	var masked []string
+	mask := func(s string) string {
+		masked = append(masked, s)
+		return fmt.Sprintf("⟦%d⟧", len(masked)-1)
+	}
+
+	// Code spans first, since their contents may look like links
+	var b strings.Builder
+	for i := 0; i < len(text); {
+		if text[i] != '`' {
+			b.WriteByte(text[i])
+			i++
+			continue
+		}
+		run := i
+		for run < len(text) && text[run] == '`' {
+			run++
+		}
+		fence := text[i:run]
+		end := strings.Index(text[run:], fence)
+		if end < 0 {
+			b.WriteString(fence)
+			i = run
+			continue
+		}
+		end += run + len(fence)
+		b.WriteString(mask(text[i:end]))
+		i = end
+	}
+	text = b.String()
+
+	text = mdAutolink.ReplaceAllStringFunc(text, mask)
+	text = mdInline.ReplaceAllStringFunc(text, mask)
+	text = mdLink.ReplaceAllStringFunc(text, func(link string) string {
+		m := mdLink.FindStringSubmatch(link)
+		if m[1] == "!" {
+			return mask(link)
+		}
+		return mask("[") + m[2] + mask("]"+m[3])
+	})
+
+	return text, masked
+}
+
+// unmaskInline restores placeholders, failing if processing dropped any
+func unmaskInline(text string, masked []string) (string, error) {
+	for i, original := range masked {
+		marker := fmt.Sprintf("⟦%d⟧", i)
+		if !strings.Contains(text, marker) {
+			return "", fmt.Errorf("processed text lost inline markup %q", original)
+		}
+		text = strings.Replace(text, marker, original, 1)
+	}
+	if placeholder.MatchString(text) {
+		return "", fmt.Errorf("processed text contains unknown placeholder")
+	}
+	return text, nil
+}
@@ -0,0 +1,64 @@
+package document
+
+import (
+	"regexp"
+	"strings"
+)
+
+// paragraphBreak separates plain-text paragraphs
+var paragraphBreak = regexp.MustCompile(`\n[ \t]*\n\s*`)
+
+// TextDocument is plain text split into paragraphs on blank lines
+type TextDocument struct {
+	blocks     []string
+	separators []string
+	paragraphs []*Paragraph
+}
+
+// ParseText splits text into paragraphs, remembering the original separators
+func ParseText(content string) *TextDocument {
+	d := &TextDocument{}
+
+	last := 0
+	for _, loc := range paragraphBreak.FindAllStringIndex(content, -1) {
+		d.blocks = append(d.blocks, content[last:loc[0]])
+		d.separators = append(d.separators, content[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	d.blocks = append(d.blocks, content[last:])
+
+	for i, block := range d.blocks {
+		index := i
+		// Keep the whitespace around the paragraph out of the processed text
+		trimmed := strings.TrimSpace(block)
+		lead := block[:strings.Index(block, trimmed)]
+		trail := block[len(lead)+len(trimmed):]
+		d.paragraphs = append(d.paragraphs, &Paragraph{
+			Text: trimmed,
+			replace: func(text string) error {
+				d.blocks[index] = lead + text + trail
+				return nil
+			},
+		})
+	}
+	return d
+}
+
+func (d *TextDocument) Format() Format {
+	return FormatText
+}
+
+func (d *TextDocument) Paragraphs() []*Paragraph {
+	return d.paragraphs
+}
+
+func (d *TextDocument) Render() (string, error) {
+	var b strings.Builder
+	for i, block := range d.blocks {
+		b.WriteString(block)
+		if i < len(d.separators) {
+			b.WriteString(d.separators[i])
+		}
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,183 @@
+package entity
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mrconter1/codeswitch-ai/pkg/tokenizer"
+)
+
+// Span is a protected name or term in a paragraph. Start and End are byte
+// offsets into the paragraph text.
+type Span struct {
+	Start int
+	End   int
+	Text  string
+}
+
+// Options are the signals used to find names besides capitalization.
+// Anchors are link texts of the paragraph; Protect and Allow are user terms
+// that are always kept or never treated as names.
+type Options struct {
+	Lang    string
+	Anchors []string
+	Protect []string
+	Allow   []string
+}
+
+// nounCapitalizing languages capitalize every noun, so capitalization says
+// nothing about names
+var nounCapitalizing = map[string]bool{
+	"de": true,
+	"lb": true,
+}
+
+// Find returns the spans of text that must not be switched:
+//   - capitalized words that do not start a sentence, joined into multi-word
+//     names ("Bill Gates")
+//   - sentence-initial words that also appear capitalized mid-sentence
+//   - link anchors that start with a capital letter
+//   - the Protect terms
+//
+// Words matching the Allow terms are only protected by Protect.
+func Find(text string, opts Options) []Span {
+	tokens := tokenizer.Tokenize(text)
+
+	var words []tokenizer.Token
+	var initial []bool
+	sentenceStart := true
+	for i, t := range tokens {
+		switch t.Kind {
+		case tokenizer.Word:
+			words = append(words, t)
+			initial = append(initial, sentenceStart)
+			sentenceStart = false
+		case tokenizer.Number:
+			// Placeholder numbers like ⟦0⟧ do not end a sentence start
+			if i == 0 || tokens[i-1].Text != "⟦" {
+				sentenceStart = false
+			}
+		case tokenizer.Punct:
+			if strings.ContainsAny(t.Text, ".!?:") {
+				sentenceStart = true
+			}
+		}
+	}
+
+	protected := make([]bool, len(words))
+	if !nounCapitalizing[baseLang(opts.Lang)] {
+		midSentence := make(map[string]bool)
+		for i, w := range words {
+			if !initial[i] && capitalized(w.Text) {
+				protected[i] = true
+				midSentence[w.Text] = true
+			}
+		}
+		for i, w := range words {
+			if initial[i] && midSentence[w.Text] {
+				protected[i] = true
+			}
+		}
+	}
+	for _, anchor := range opts.Anchors {
+		if first, _ := utf8.DecodeRuneInString(strings.TrimSpace(anchor)); !unicode.IsUpper(first) {
+			continue
+		}
+		markTerm(words, anchor, protected)
+	}
+
+	allowed := make([]bool, len(words))
+	for _, term := range opts.Allow {
+		markTerm(words, term, allowed)
+	}
+	for i := range protected {
+		if allowed[i] {
+			protected[i] = false
+		}
+	}
+	for _, term := range opts.Protect {
+		markTerm(words, term, protected)
+	}
+
+	return spans(text, words, protected)
+}
+
+// capitalized reports whether a word starts with a capital letter. Single
+// letters ("I") are not names.
+func capitalized(word string) bool {
+	r, size := utf8.DecodeRuneInString(word)
+	return size < len(word) && (unicode.IsUpper(r) || unicode.IsTitle(r))
+}
+
+// markTerm marks every occurrence of term's word sequence, ignoring case
+func markTerm(words []tokenizer.Token, term string, marks []bool) {
+	var pattern []string
+	for _, t := range tokenizer.Words(term) {
+		pattern = append(pattern, t.Normalized())
+	}
+	if len(pattern) == 0 {
+		return
+	}
+
+	for i := 0; i+len(pattern) <= len(words); i++ {
+		match := true
+		for j, p := range pattern {
+			if words[i+j].Normalized() != p {
+				match = false
+				break
+			}
+		}
+		if match {
+			for j := range pattern {
+				marks[i+j] = true
+			}
+		}
+	}
+}
+
+// spans joins protected words separated only by whitespace
+func spans(text string, words []tokenizer.Token, protected []bool) []Span {
+	var result []Span
+	for i := 0; i < len(words); i++ {
+		if !protected[i] {
+			continue
+		}
+		span := Span{Start: words[i].Start, End: words[i].End}
+		for i+1 < len(words) && protected[i+1] && strings.TrimSpace(text[span.End:words[i+1].Start]) == "" {
+			i++
+			span.End = words[i].End
+		}
+		span.Text = text[span.Start:span.End]
+		result = append(result, span)
+	}
+	return result
+}
+
+// Contains reports whether the token lies within one of the spans
+func Contains(spans []Span, t tokenizer.Token) bool {
+	for _, s := range spans {
+		if t.Start < s.End && t.End > s.Start {
+			return true
+		}
+	}
+	return false
+}
+
+// Terms returns the distinct texts of the spans in order of appearance
+func Terms(spans []Span) []string {
+	seen := make(map[string]bool)
+	var terms []string
+	for _, s := range spans {
+		if !seen[s.Text] {
+			seen[s.Text] = true
+			terms = append(terms, s.Text)
+		}
+	}
+	return terms
+}
+
+func baseLang(code string) string {
+	base, _, _ := strings.Cut(strings.ToLower(code), "_")
+	return base
+}
@@ -0,0 +1,156 @@
+package experiment
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/mrconter1/codeswitch-ai/internal/prompt"
+)
+
+// Config is the set of running experiments, read from a JSON file:
+//
+//	{"experiments": [{"name": "context-v3", "variants": [
+//	    {"name": "control", "weight": 1},
+//	    {"name": "treatment", "weight": 1, "promptDir": "prompts/v3", "model": "claude-3-5-sonnet-20240620"}
+//	]}]}
+//
+// Every request is assigned one variant of each experiment. A variant with
+// no promptDir or model keeps the service's prompt templates or model.
+type Config struct {
+	Experiments []Experiment `json:"experiments"`
+}
+
+// Experiment splits traffic between its variants in proportion to their
+// weights
+type Experiment struct {
+	Name     string    `json:"name"`
+	Variants []Variant `json:"variants"`
+}
+
+// Variant is a prompt template set and model to compare
+type Variant struct {
+	Name      string `json:"name"`
+	Weight    int    `json:"weight"`
+	PromptDir string `json:"promptDir,omitempty"`
+	Model     string `json:"model,omitempty"`
+
+	// Prompts is loaded from PromptDir, nil when it is empty
+	Prompts *prompt.Set `json:"-"`
+}
+
+// Assignment is the variant of an experiment a request was assigned to
+type Assignment struct {
+	Experiment string `json:"experiment"`
+	Variant    string `json:"variant"`
+
+	variant *Variant
+}
+
+// Load reads and checks the experiments in a JSON file and loads the
+// prompt templates of their variants. An empty path means no experiments.
+func Load(path string) (*Config, error) {
+	c := &Config{}
+	if path == "" {
+		return c, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	names := make(map[string]bool)
+	for i := range c.Experiments {
+		e := &c.Experiments[i]
+		switch {
+		case e.Name == "":
+			return nil, fmt.Errorf("experiment %d has no name", i+1)
+		case names[e.Name]:
+			return nil, fmt.Errorf("duplicate experiment %q", e.Name)
+		case len(e.Variants) < 2:
+			return nil, fmt.Errorf("experiment %q needs at least two variants", e.Name)
+		}
+		names[e.Name] = true
+
+		variants := make(map[string]bool)
+		for j := range e.Variants {
+			v := &e.Variants[j]
+			switch {
+			case v.Name == "":
+				return nil, fmt.Errorf("experiment %q: variant %d has no name", e.Name, j+1)
+			case variants[v.Name]:
+				return nil, fmt.Errorf("experiment %q: duplicate variant %q", e.Name, v.Name)
+			case v.Weight < 0:
+				return nil, fmt.Errorf("experiment %q: variant %q has a negative weight", e.Name, v.Name)
+			case v.Weight == 0:
+				v.Weight = 1
+			}
+			variants[v.Name] = true
+
+			if v.PromptDir != "" {
+				if v.Prompts, err = prompt.LoadDir(v.PromptDir); err != nil {
+					return nil, fmt.Errorf("experiment %q: variant %q: %v", e.Name, v.Name, err)
+				}
+			}
+		}
+	}
+	return c, nil
+}
+
+// Assign picks a variant of every experiment for a request identified by
+// key. The same key always gets the same variants, and keys are spread over
+// the variants in proportion to their weights.
+func (c *Config) Assign(key []byte) []Assignment {
+	var assignments []Assignment
+	for i := range c.Experiments {
+		e := &c.Experiments[i]
+		total := 0
+		for _, v := range e.Variants {
+			total += v.Weight
+		}
+
+		// Hashing the experiment name along with the key makes the splits of
+		// different experiments independent
+		hash := sha256.New()
+		hash.Write([]byte(e.Name))
+		hash.Write([]byte{0})
+		hash.Write(key)
+		point := int(binary.BigEndian.Uint64(hash.Sum(nil)) % uint64(total))
+
+		for j := range e.Variants {
+			v := &e.Variants[j]
+			if point < v.Weight {
+				assignments = append(assignments, Assignment{Experiment: e.Name, Variant: v.Name, variant: v})
+				break
+			}
+			point -= v.Weight
+		}
+	}
+	return assignments
+}
+
+// Overrides returns the prompt templates and model to use for a request
+// assigned to the given variants, nil and empty for the service defaults.
+// When several experiments set the same thing, the last one wins.
+func Overrides(assignments []Assignment) (*prompt.Set, string) {
+	var prompts *prompt.Set
+	var model string
+	for _, a := range assignments {
+		if a.variant == nil {
+			continue
+		}
+		if a.variant.Prompts != nil {
+			prompts = a.variant.Prompts
+		}
+		if a.variant.Model != "" {
+			model = a.variant.Model
+		}
+	}
+	return prompts, model
+}
@@ -0,0 +1,163 @@
+package experiment
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/mrconter1/codeswitch-ai/api"
+	"github.com/mrconter1/codeswitch-ai/pkg/cache"
+	"github.com/mrconter1/codeswitch-ai/pkg/claude"
+)
+
+// assignmentTTL is how long a request can be rated after it was served
+const assignmentTTL = 30 * 24 * time.Hour
+
+// ErrUnknownRequest is returned when rating a request that was not assigned
+// to any variant, has expired or was rated already
+var ErrUnknownRequest = errors.New("unknown or already rated request")
+
+// Outcome is what a request measured for the variants it was assigned to.
+// Of the Checked paragraphs, whose model output went through the output
+// checks, Passed were accepted. Of the Measured paragraphs, whose share of
+// switched words was measured, Within were within tolerance of the target;
+// AbsError sums their distance to it.
+type Outcome struct {
+	Paragraphs int
+	Checked    int
+	Passed     int
+	Measured   int
+	Within     int
+	AbsError   float64
+	Usage      claude.Usage
+	Latency    time.Duration
+}
+
+// Metrics aggregates outcomes and user ratings per variant in Redis hashes
+// at "experiment:<experiment>:<variant>"
+type Metrics struct {
+	cache *cache.Cache
+}
+
+// NewMetrics creates metrics stored in cache
+func NewMetrics(cache *cache.Cache) *Metrics {
+	return &Metrics{cache: cache}
+}
+
+func metricsKey(experiment, variant string) string {
+	return fmt.Sprintf("experiment:%s:%s", experiment, variant)
+}
+
+func requestKey(requestID string) string {
+	return "experiment:request:" + requestID
+}
+
+// Record adds the outcome of a request to every variant it was assigned to,
+// and remembers the assignments under requestID for a later rating
+func (m *Metrics) Record(ctx context.Context, requestID string, assignments []Assignment, o Outcome) error {
+	values := map[string]float64{
+		"requests":            1,
+		"paragraphs":          float64(o.Paragraphs),
+		"checked":             float64(o.Checked),
+		"passed":              float64(o.Passed),
+		"measured":            float64(o.Measured),
+		"within":              float64(o.Within),
+		"errorSum":            o.AbsError,
+		"inputTokens":         float64(o.Usage.InputTokens),
+		"outputTokens":        float64(o.Usage.OutputTokens),
+		"cacheCreationTokens": float64(o.Usage.CacheCreationInputTokens),
+		"cacheReadTokens":     float64(o.Usage.CacheReadInputTokens),
+		"latencyMs":           float64(o.Latency.Milliseconds()),
+	}
+	for _, a := range assignments {
+		if err := m.cache.IncrementFields(ctx, metricsKey(a.Experiment, a.Variant), values); err != nil {
+			return fmt.Errorf("error recording %s/%s: %v", a.Experiment, a.Variant, err)
+		}
+	}
+
+	data, err := json.Marshal(assignments)
+	if err != nil {
+		return err
+	}
+	return m.cache.Set(ctx, requestKey(requestID), data, assignmentTTL)
+}
+
+// Rate adds a user rating of a request to the variants it was assigned to.
+// Each request can be rated once: the assignments are taken out of the
+// cache atomically, so of concurrent ratings only the first counts.
+func (m *Metrics) Rate(ctx context.Context, requestID string, rating int) error {
+	data, err := m.cache.GetDelete(ctx, requestKey(requestID))
+	if err != nil {
+		return ErrUnknownRequest
+	}
+	var assignments []Assignment
+	if err := json.Unmarshal([]byte(data), &assignments); err != nil {
+		return fmt.Errorf("error decoding assignments: %v", err)
+	}
+
+	values := map[string]float64{"ratings": 1, "ratingSum": float64(rating)}
+	for _, a := range assignments {
+		if err := m.cache.IncrementFields(ctx, metricsKey(a.Experiment, a.Variant), values); err != nil {
+			return fmt.Errorf("error rating %s/%s: %v", a.Experiment, a.Variant, err)
+		}
+	}
+	return nil
+}
+
+// Report summarizes the metrics of every variant of the configured
+// experiments
+func (m *Metrics) Report(ctx context.Context, config *Config) ([]api.ExperimentReport, error) {
+	reports := []api.ExperimentReport{}
+	for _, e := range config.Experiments {
+		report := api.ExperimentReport{Name: e.Name}
+		for _, v := range e.Variants {
+			fields, err := m.cache.GetFields(ctx, metricsKey(e.Name, v.Name))
+			if err != nil {
+				return nil, fmt.Errorf("error reading %s/%s: %v", e.Name, v.Name, err)
+			}
+			report.Variants = append(report.Variants, variantReport(v, fields))
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+// variantReport turns the counters of a variant into rates and means
+func variantReport(v Variant, fields map[string]string) api.VariantReport {
+	value := func(name string) float64 {
+		f, _ := strconv.ParseFloat(fields[name], 64)
+		return f
+	}
+	ratio := func(num, den float64) float64 {
+		if den == 0 {
+			return 0
+		}
+		return num / den
+	}
+
+	requests, paragraphs := value("requests"), value("paragraphs")
+	r := api.VariantReport{
+		Name:                    v.Name,
+		Weight:                  v.Weight,
+		Model:                   v.Model,
+		Requests:                int(requests),
+		Paragraphs:              int(paragraphs),
+		PassRate:                ratio(value("passed"), value("checked")),
+		ToleranceRate:           ratio(value("within"), value("measured")),
+		MeanError:               ratio(value("errorSum"), value("measured")),
+		MeanInputTokens:         ratio(value("inputTokens"), paragraphs),
+		MeanOutputTokens:        ratio(value("outputTokens"), paragraphs),
+		MeanCacheCreationTokens: ratio(value("cacheCreationTokens"), paragraphs),
+		MeanCacheReadTokens:     ratio(value("cacheReadTokens"), paragraphs),
+		MeanLatencyMs:           ratio(value("latencyMs"), paragraphs),
+		Ratings:                 int(value("ratings")),
+		MeanRating:              ratio(value("ratingSum"), value("ratings")),
+	}
+	if v.Prompts != nil {
+		r.PromptVersion = v.Prompts.Version()
+	}
+	return r
+}
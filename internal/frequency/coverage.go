@@ -0,0 +1,127 @@
+package frequency
+
+import (
+	"math"
+	"sort"
+)
+
+// DefaultMaxRank bounds Zipf extrapolation: the vocabulary is assumed to end
+// after this many ranks, which keeps the tail finite for exponents <= 1
+const DefaultMaxRank = 1000000
+
+// Coverage answers how much of running text the top ranked words of a list
+// account for, computed from the corpus counts of the list. A Zipf law
+// count(r) = scale * r^-exponent fitted to the counts extends the curve past
+// the end of the list.
+type Coverage struct {
+	cumulative []int64
+	total      int64
+	exponent   float64
+	scale      float64
+}
+
+func newCoverage(words []WordFrequency) *Coverage {
+	c := &Coverage{cumulative: make([]int64, len(words))}
+
+	var sum int64
+	for i, wf := range words {
+		sum += int64(wf.Count)
+		c.cumulative[i] = sum
+	}
+	c.total = sum
+	c.exponent, c.scale = fitZipf(words)
+
+	return c
+}
+
+// fitZipf fits log(count) = log(scale) - exponent*log(rank) by least squares
+func fitZipf(words []WordFrequency) (exponent, scale float64) {
+	var n, sx, sy, sxx, sxy float64
+	for i, wf := range words {
+		if wf.Count <= 0 {
+			continue
+		}
+		x := math.Log(float64(i + 1))
+		y := math.Log(float64(wf.Count))
+		n++
+		sx += x
+		sy += y
+		sxx += x * x
+		sxy += x * y
+	}
+	if n < 2 || n*sxx-sx*sx == 0 {
+		return 1, 0
+	}
+
+	slope := (n*sxy - sx*sy) / (n*sxx - sx*sx)
+	intercept := (sy - slope*sx) / n
+	return -slope, math.Exp(intercept)
+}
+
+// Len returns the number of ranks backed by real counts
+func (c *Coverage) Len() int {
+	return len(c.cumulative)
+}
+
+// Exponent returns the fitted Zipf exponent
+func (c *Coverage) Exponent() float64 {
+	return c.exponent
+}
+
+// At returns the share of the list's tokens covered by the top rank words
+func (c *Coverage) At(rank int) float64 {
+	if rank <= 0 || c.total == 0 {
+		return 0
+	}
+	if rank >= len(c.cumulative) {
+		return 1
+	}
+	return float64(c.cumulative[rank-1]) / float64(c.total)
+}
+
+// RankFor returns the smallest number of top words covering at least
+// fraction of the list's tokens, by binary search over the cumulative counts
+func (c *Coverage) RankFor(fraction float64) int {
+	if fraction <= 0 {
+		return 0
+	}
+	if fraction >= 1 {
+		return len(c.cumulative)
+	}
+	needed := fraction * float64(c.total)
+	return sort.Search(len(c.cumulative), func(i int) bool {
+		return float64(c.cumulative[i]) >= needed
+	}) + 1
+}
+
+// Extrapolated returns the share of all running text covered by the top
+// rank words, assuming the fitted Zipf law continues past the list up to
+// maxRank. Unlike At it accounts for the words missing from the list.
+func (c *Coverage) Extrapolated(rank, maxRank int) float64 {
+	n := len(c.cumulative)
+	if rank <= 0 || c.total == 0 {
+		return 0
+	}
+	if maxRank < n {
+		maxRank = n
+	}
+
+	estimatedTotal := float64(c.total) + c.tail(n, maxRank)
+	if rank <= n {
+		return float64(c.cumulative[rank-1]) / estimatedTotal
+	}
+	return (float64(c.total) + c.tail(n, min(rank, maxRank))) / estimatedTotal
+}
+
+// tail estimates the tokens of ranks (from, to] as the integral of the
+// fitted Zipf law
+func (c *Coverage) tail(from, to int) float64 {
+	if to <= from {
+		return 0
+	}
+	a, b := float64(from)+0.5, float64(to)+0.5
+	if math.Abs(c.exponent-1) < 1e-9 {
+		return c.scale * math.Log(b/a)
+	}
+	return c.scale * (math.Pow(b, 1-c.exponent) - math.Pow(a, 1-c.exponent)) / (1 - c.exponent)
+}
@@ -0,0 +1,101 @@
+package frequency
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// WordFrequency is a word and the number of times it occurs in the corpus
+type WordFrequency struct {
+	Word  string
+	Count int
+}
+
+// List is the frequency-ranked vocabulary of one language, most frequent first
+type List struct {
+	Lang  string
+	Words []WordFrequency
+
+	// ranks indexes Words by word, built once when the list is parsed
+	ranks      map[string]int
+	maxWordLen int
+
+	coverage     *Coverage
+	coverageOnce sync.Once
+}
+
+// Coverage returns the coverage curve of the list, computed on first use
+func (l *List) Coverage() *Coverage {
+	l.coverageOnce.Do(func() {
+		l.coverage = newCoverage(l.Words)
+	})
+	return l.coverage
+}
+
+// Len returns the number of ranked words
+func (l *List) Len() int {
+	return len(l.Words)
+}
+
+// Rank returns the 1-based rank of word, or 0 if it is not in the list
+func (l *List) Rank(word string) int {
+	if rank, ok := l.ranks[word]; ok {
+		return rank
+	}
+	return l.ranks[strings.ToLower(word)]
+}
+
+// buildIndex maps every word to its rank. Duplicate spellings keep the
+// better rank.
+func (l *List) buildIndex() {
+	l.ranks = make(map[string]int, len(l.Words))
+	for i, wf := range l.Words {
+		if _, ok := l.ranks[wf.Word]; !ok {
+			l.ranks[wf.Word] = i + 1
+		}
+		l.maxWordLen = max(l.maxWordLen, utf8.RuneCountInString(wf.Word))
+	}
+}
+
+// Contains reports whether word is in the list. Together with MaxWordLen it
+// lets the list serve as the lexicon for segmenting unspaced scripts.
+func (l *List) Contains(word string) bool {
+	return l.Rank(word) > 0
+}
+
+// MaxWordLen returns the length in runes of the longest word in the list
+func (l *List) MaxWordLen() int {
+	return l.maxWordLen
+}
+
+// Parse reads a list in the FrequencyWords format: one "word count" pair per
+// line, most frequent first
+func Parse(lang string, r io.Reader) (*List, error) {
+	list := &List{Lang: lang}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		parts := strings.Fields(scanner.Text())
+		if len(parts) == 2 {
+			count := 0
+			fmt.Sscanf(parts[1], "%d", &count)
+			list.Words = append(list.Words, WordFrequency{
+				Word:  strings.ToLower(parts[0]),
+				Count: count,
+			})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading %s frequency list: %v", lang, err)
+	}
+	if len(list.Words) == 0 {
+		return nil, fmt.Errorf("no words found for language %s", lang)
+	}
+	list.buildIndex()
+
+	return list, nil
+}
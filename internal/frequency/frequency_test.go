@@ -0,0 +1,178 @@
+package frequency
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// zipfList builds a list of n words with Zipf distributed counts, the size
+// of a FrequencyWords list
+func zipfList(tb testing.TB, n int) *List {
+	tb.Helper()
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&b, "word%d %d\n", i, 10000000/i)
+	}
+	list, err := Parse("en", strings.NewReader(b.String()))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return list
+}
+
+// BenchmarkCoverage builds the coverage table, once per language
+func BenchmarkCoverage(b *testing.B) {
+	list := zipfList(b, 50000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		newCoverage(list.Words)
+	}
+}
+
+// BenchmarkRankFor finds the cutoff of a target share, once per paragraph
+func BenchmarkRankFor(b *testing.B) {
+	coverage := zipfList(b, 50000).Coverage()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		coverage.RankFor(float64(i%100) / 100)
+	}
+}
+
+// legacyRankFor is the harmonic sum estimate of the words needed that the
+// coverage table replaced, kept as a baseline for BenchmarkRankFor
+func legacyRankFor(list *List, fraction float64) int {
+	total := 0.0
+	for i := range list.Words {
+		total += 1.0 / float64(i+1)
+	}
+	cumulative := 0.0
+	for i := range list.Words {
+		cumulative += 1.0 / float64(i+1)
+		if cumulative/total >= fraction {
+			return i + 1
+		}
+	}
+	return len(list.Words)
+}
+
+func BenchmarkLegacyRankFor(b *testing.B) {
+	list := zipfList(b, 50000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		legacyRankFor(list, float64(i%100)/100)
+	}
+}
+
+// BenchmarkRank looks a word up, once per token
+func BenchmarkRank(b *testing.B) {
+	list := zipfList(b, 50000)
+	words := []string{"word1", "word250", "word49999", "Word42", "missing"}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		list.Rank(words[i%len(words)])
+	}
+}
+
+// blockingSource serves every language, holding en until release is closed
+type blockingSource struct {
+	release chan struct{}
+	opens   atomic.Int32
+}
+
+func (s *blockingSource) Open(lang string) (io.ReadCloser, error) {
+	if lang == "xx" {
+		return nil, fs.ErrNotExist
+	}
+	if lang == "en" {
+		s.opens.Add(1)
+		<-s.release
+	}
+	return io.NopCloser(strings.NewReader("the 10\nof 5\n")), nil
+}
+
+func (s *blockingSource) String() string {
+	return "blocking"
+}
+
+func TestRegistryLoadsOutsideLock(t *testing.T) {
+	source := &blockingSource{release: make(chan struct{})}
+	registry := NewRegistry(source)
+
+	var wg sync.WaitGroup
+	lists := make([]*List, 3)
+	for i := range lists {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			list, err := registry.Get("en")
+			if err != nil {
+				t.Error(err)
+			}
+			lists[i] = list
+		}()
+	}
+
+	// Another language is served while en is still loading
+	for source.opens.Load() == 0 {
+		runtime.Gosched()
+	}
+	if _, err := registry.Get("sv"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registry.Get("xx"); err == nil {
+		t.Error("missing language loaded")
+	}
+
+	close(source.release)
+	wg.Wait()
+	if n := source.opens.Load(); n != 1 {
+		t.Errorf("en opened %d times, want 1", n)
+	}
+	for _, list := range lists {
+		if list == nil || list != lists[0] {
+			t.Fatal("concurrent requests got different lists")
+		}
+	}
+}
+
+func TestRegistryLanguage(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"dv.txt":  "the 10\n",
+		"dv.lang": "# Dhivehi\nscript Thaa\ndirection rtl\n",
+		"ar.txt":  "the 10\n",
+		"ar.lang": "direction ltr\n",
+		"xx.lang": "direction sideways\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	registry := NewRegistry(Dir(dir))
+
+	tests := []struct {
+		code string
+		want Language
+	}{
+		{"dv", Language{Code: "dv", Script: "Thaa", Direction: RTL}},
+		// Missing keys keep what LookupLanguage knows
+		{"ar", Language{Code: "ar", Script: "Arab", Direction: LTR}},
+		// Invalid metadata is ignored
+		{"xx", Language{Code: "xx", Script: "Latn", Direction: LTR}},
+		{"he", Language{Code: "he", Script: "Hebr", Direction: RTL}},
+	}
+	for _, tt := range tests {
+		if got := registry.Language(tt.code); got != tt.want {
+			t.Errorf("Language(%q) = %+v, want %+v", tt.code, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+//go:build ignore
+
+// gen downloads FrequencyWords lists into the data directory so they can be
+// embedded into the binary.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mrconter1/codeswitch-ai/internal/frequency"
+)
+
+func main() {
+	langs := flag.String("langs", "en,sv", "Comma separated language codes")
+	out := flag.String("out", "data", "Output directory")
+	flag.Parse()
+
+	for _, lang := range strings.Split(*langs, ",") {
+		url := fmt.Sprintf(frequency.DefaultURLTemplate, lang, lang)
+		log.Printf("Fetching %s", url)
+
+		resp, err := http.Get(url)
+		if err != nil {
+			log.Fatalf("Error fetching %s: %v", lang, err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			log.Fatalf("Error fetching %s: status %d", lang, resp.StatusCode)
+		}
+
+		f, err := os.Create(filepath.Join(*out, lang+".txt"))
+		if err != nil {
+			log.Fatalf("Error creating list for %s: %v", lang, err)
+		}
+		if _, err := io.Copy(f, resp.Body); err != nil {
+			log.Fatalf("Error writing list for %s: %v", lang, err)
+		}
+		resp.Body.Close()
+		f.Close()
+	}
+}
@@ -0,0 +1,132 @@
+package frequency
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+// CurvePoint is the coverage reached by the top Rank words
+type CurvePoint struct {
+	Rank         int     `json:"rank"`
+	Coverage     float64 `json:"coverage"`
+	Extrapolated float64 `json:"extrapolated,omitempty"`
+}
+
+// CurveResponse is the rank → coverage curve of a language
+type CurveResponse struct {
+	Language string       `json:"language"`
+	Words    int          `json:"words"`
+	Exponent float64      `json:"exponent"`
+	Points   []CurvePoint `json:"points"`
+}
+
+// Bounds of the coverage curve. The endpoint is public, so neither the
+// extrapolated range nor the number of points may be unbounded.
+const (
+	defaultCurvePoints = 200
+	maxCurvePoints     = 2000
+	// maxFullRanks bounds full=true, which returns every rank
+	maxFullRanks = 100000
+	// maxRankFactor bounds maxRank relative to the list, beyond DefaultMaxRank
+	maxRankFactor = 10
+)
+
+// CoverageHandler serves GET ?lang=en with the coverage curve of a language.
+// By default the curve is sampled at ~200 log-spaced ranks; full=true returns
+// every rank, up to maxFullRanks. extrapolate=true adds the Zipf
+// extrapolated share of all text and extends the curve to maxRank. Values
+// out of range are rejected with 400.
+func CoverageHandler(registry *Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		query := r.URL.Query()
+		list, err := registry.Get(query.Get("lang"))
+		if err != nil {
+			status := http.StatusServiceUnavailable
+			if errors.Is(err, ErrNoList) || errors.Is(err, ErrInvalidCode) {
+				status = http.StatusBadRequest
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		extrapolate := query.Get("extrapolate") == "true"
+		maxRank := list.Len()
+		if extrapolate {
+			maxRank = DefaultMaxRank
+			if v := query.Get("maxRank"); v != "" {
+				limit := max(DefaultMaxRank, maxRankFactor*list.Len())
+				n, err := strconv.Atoi(v)
+				if err != nil || n < 1 || n > limit {
+					http.Error(w, fmt.Sprintf("maxRank must be between 1 and %d", limit), http.StatusBadRequest)
+					return
+				}
+				maxRank = n
+			}
+		}
+		points := defaultCurvePoints
+		if v := query.Get("points"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 2 || n > maxCurvePoints {
+				http.Error(w, fmt.Sprintf("points must be between 2 and %d", maxCurvePoints), http.StatusBadRequest)
+				return
+			}
+			points = n
+		}
+		if query.Get("full") == "true" {
+			if maxRank > maxFullRanks {
+				http.Error(w, fmt.Sprintf("full=true covers at most %d ranks, use points instead", maxFullRanks), http.StatusBadRequest)
+				return
+			}
+			points = maxRank
+		}
+
+		coverage := list.Coverage()
+		response := CurveResponse{
+			Language: list.Lang,
+			Words:    list.Len(),
+			Exponent: coverage.Exponent(),
+		}
+		for _, rank := range sampleRanks(maxRank, points) {
+			point := CurvePoint{Rank: rank, Coverage: coverage.At(rank)}
+			if extrapolate {
+				point.Extrapolated = coverage.Extrapolated(rank, maxRank)
+			}
+			response.Points = append(response.Points, point)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// sampleRanks returns up to points distinct ranks in [1, maxRank], spaced
+// logarithmically so the head of the curve is well resolved
+func sampleRanks(maxRank, points int) []int {
+	if points >= maxRank {
+		ranks := make([]int, maxRank)
+		for i := range ranks {
+			ranks[i] = i + 1
+		}
+		return ranks
+	}
+
+	var ranks []int
+	last := 0
+	for i := 0; i < points; i++ {
+		rank := int(math.Round(math.Pow(float64(maxRank), float64(i)/float64(points-1))))
+		if rank > last {
+			ranks = append(ranks, rank)
+			last = rank
+		}
+	}
+	return ranks
+}
@@ -0,0 +1,105 @@
+package frequency
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Direction is the writing direction of a script
+type Direction string
+
+const (
+	LTR Direction = "ltr"
+	RTL Direction = "rtl"
+)
+
+// Language describes how a language is written. Script is an ISO 15924 code.
+type Language struct {
+	Code      string
+	Script    string
+	Direction Direction
+}
+
+// languages records the writing system of languages whose script is not
+// Latin, and of Latin languages we support explicitly
+var languages = map[string]Language{
+	"en":    {Script: "Latn", Direction: LTR},
+	"sv":    {Script: "Latn", Direction: LTR},
+	"de":    {Script: "Latn", Direction: LTR},
+	"fr":    {Script: "Latn", Direction: LTR},
+	"es":    {Script: "Latn", Direction: LTR},
+	"ar":    {Script: "Arab", Direction: RTL},
+	"fa":    {Script: "Arab", Direction: RTL},
+	"ur":    {Script: "Arab", Direction: RTL},
+	"he":    {Script: "Hebr", Direction: RTL},
+	"yi":    {Script: "Hebr", Direction: RTL},
+	"ru":    {Script: "Cyrl", Direction: LTR},
+	"uk":    {Script: "Cyrl", Direction: LTR},
+	"bg":    {Script: "Cyrl", Direction: LTR},
+	"sr":    {Script: "Cyrl", Direction: LTR},
+	"el":    {Script: "Grek", Direction: LTR},
+	"hi":    {Script: "Deva", Direction: LTR},
+	"ko":    {Script: "Kore", Direction: LTR},
+	"ja":    {Script: "Jpan", Direction: LTR},
+	"zh":    {Script: "Hans", Direction: LTR},
+	"zh_cn": {Script: "Hans", Direction: LTR},
+	"zh_tw": {Script: "Hant", Direction: LTR},
+	"th":    {Script: "Thai", Direction: LTR},
+	"lo":    {Script: "Laoo", Direction: LTR},
+	"km":    {Script: "Khmr", Direction: LTR},
+	"my":    {Script: "Mymr", Direction: LTR},
+}
+
+// LookupLanguage returns the writing system of a language code, falling back
+// to the base language ("pt_br" → "pt") and then to left-to-right Latin
+func LookupLanguage(code string) Language {
+	if lang, ok := languages[code]; ok {
+		lang.Code = code
+		return lang
+	}
+	if base, _, found := strings.Cut(code, "_"); found {
+		if lang, ok := languages[base]; ok {
+			lang.Code = code
+			return lang
+		}
+	}
+	return Language{Code: code, Script: "Latn", Direction: LTR}
+}
+
+// ParseLanguage reads the writing system of code from a metadata file of
+// "key value" lines, such as "script Arab" and "direction rtl"; lines
+// starting with # are comments. Missing keys keep what LookupLanguage knows.
+func ParseLanguage(code string, r io.Reader) (Language, error) {
+	lang := LookupLanguage(code)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, _ := strings.Cut(line, " ")
+		value = strings.TrimSpace(value)
+		switch key {
+		case "script":
+			if len(value) != 4 {
+				return Language{}, fmt.Errorf("invalid script %q", value)
+			}
+			lang.Script = value
+		case "direction":
+			switch direction := Direction(strings.ToLower(value)); direction {
+			case LTR, RTL:
+				lang.Direction = direction
+			default:
+				return Language{}, fmt.Errorf("invalid direction %q", value)
+			}
+		default:
+			return Language{}, fmt.Errorf("unknown key %q", key)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Language{}, err
+	}
+	return lang, nil
+}
@@ -0,0 +1,185 @@
+package frequency
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// DefaultURLTemplate locates the FrequencyWords list of a language; the
+// language code is substituted twice
+const DefaultURLTemplate = "https://raw.githubusercontent.com/hermitdave/FrequencyWords/master/content/2018/%s/%s_50k.txt"
+
+// ErrNoList is returned when no source has a list for a language
+var ErrNoList = errors.New("no frequency list available")
+
+// languageCode matches ISO 639-1/639-3 codes, optionally with a region or
+// script suffix as used by FrequencyWords (pt_br, zh_cn, sr_latn)
+var languageCode = regexp.MustCompile(`^[a-z]{2,3}(_[a-z]{2,4})?$`)
+
+// Registry loads frequency lists per language on first use and keeps them in
+// memory. Sources are tried in order until one has a list for the language.
+// Failed loads are not remembered, so the next request retries.
+type Registry struct {
+	sources []Source
+
+	mu        sync.Mutex
+	lists     map[string]*List
+	loading   map[string]*pending
+	languages map[string]Language
+}
+
+// pending is a load in progress; done is closed once list or err is set
+type pending struct {
+	done chan struct{}
+	list *List
+	err  error
+}
+
+// NewRegistry creates a registry reading from the given sources, or from the
+// embedded lists when none are given
+func NewRegistry(sources ...Source) *Registry {
+	if len(sources) == 0 {
+		sources = []Source{Embedded()}
+	}
+	return &Registry{
+		sources:   sources,
+		lists:     make(map[string]*List),
+		loading:   make(map[string]*pending),
+		languages: make(map[string]Language),
+	}
+}
+
+// ErrInvalidCode is returned for strings that are not language codes
+var ErrInvalidCode = errors.New("invalid language code")
+
+// ValidateCode checks that lang looks like a language code
+func ValidateCode(lang string) error {
+	if !languageCode.MatchString(lang) {
+		return fmt.Errorf("%w %q", ErrInvalidCode, lang)
+	}
+	return nil
+}
+
+// Get returns the list for lang, loading it if needed. The lock is not held
+// while loading, which may download, so other languages are served
+// meanwhile; concurrent requests for the same language wait for one load.
+func (r *Registry) Get(lang string) (*List, error) {
+	if err := ValidateCode(lang); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	if list, ok := r.lists[lang]; ok {
+		r.mu.Unlock()
+		return list, nil
+	}
+	if p, ok := r.loading[lang]; ok {
+		r.mu.Unlock()
+		<-p.done
+		return p.list, p.err
+	}
+	p := &pending{done: make(chan struct{})}
+	r.loading[lang] = p
+	r.mu.Unlock()
+
+	p.list, p.err = r.load(lang)
+
+	r.mu.Lock()
+	delete(r.loading, lang)
+	if p.err == nil {
+		r.lists[lang] = p.list
+	}
+	r.mu.Unlock()
+	close(p.done)
+
+	return p.list, p.err
+}
+
+func (r *Registry) load(lang string) (*List, error) {
+	log.Printf("Loading frequency dictionary for %s...", lang)
+
+	var errs []string
+	for _, source := range r.sources {
+		rc, err := source.Open(lang)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", source, err))
+			continue
+		}
+
+		list, err := Parse(lang, rc)
+		rc.Close()
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", source, err))
+			continue
+		}
+
+		// Precompute the coverage table so requests only do lookups
+		list.Coverage()
+
+		log.Printf("Loaded %d words for language %s from %s", list.Len(), lang, source)
+		return list, nil
+	}
+
+	if len(errs) == 0 {
+		if len(EmbeddedLanguages()) == 0 {
+			return nil, fmt.Errorf("%w for language %s (none bundled; run go generate ./internal/frequency before building)", ErrNoList, lang)
+		}
+		return nil, fmt.Errorf("%w for language %s", ErrNoList, lang)
+	}
+	return nil, fmt.Errorf("failed to load frequency list for language %s: %s", lang, strings.Join(errs, "; "))
+}
+
+// Language returns the writing system of a language: from a <lang>.lang file
+// next to its list when a source has one, so languages of a custom list
+// directory can declare theirs, and otherwise from LookupLanguage
+func (r *Registry) Language(code string) Language {
+	if ValidateCode(code) != nil {
+		return LookupLanguage(code)
+	}
+
+	r.mu.Lock()
+	lang, ok := r.languages[code]
+	r.mu.Unlock()
+	if ok {
+		return lang
+	}
+
+	lang = r.loadLanguage(code)
+	r.mu.Lock()
+	r.languages[code] = lang
+	r.mu.Unlock()
+	return lang
+}
+
+func (r *Registry) loadLanguage(code string) Language {
+	for _, source := range r.sources {
+		ls, ok := source.(languageSource)
+		if !ok {
+			continue
+		}
+		rc, err := ls.OpenLanguage(code)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			log.Printf("Error opening language metadata for %s from %s: %v", code, source, err)
+			continue
+		}
+		lang, err := ParseLanguage(code, rc)
+		rc.Close()
+		if err != nil {
+			log.Printf("Error reading language metadata for %s from %s: %v", code, source, err)
+			continue
+		}
+		return lang
+	}
+	return LookupLanguage(code)
+}
@@ -0,0 +1,224 @@
+package frequency
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+//go:generate go run gen.go -langs en,sv -out data
+
+// bundled holds the frequency lists compiled into the binary, one
+// data/<lang>.txt file per default language
+//
+//go:embed data
+var bundled embed.FS
+
+// Source provides the raw frequency list of a language in the FrequencyWords
+// format. Open returns an error wrapping fs.ErrNotExist when the source has
+// no list for the language, so the registry moves on to the next source.
+type Source interface {
+	Open(lang string) (io.ReadCloser, error)
+	String() string
+}
+
+// languageSource is a Source that may also hold the writing system of a
+// language in a <lang>.lang file next to its list, read by ParseLanguage
+type languageSource interface {
+	OpenLanguage(lang string) (io.ReadCloser, error)
+}
+
+// Embedded returns the lists bundled into the binary
+func Embedded() Source {
+	return fsSource{fsys: bundled, dir: "data", name: "embedded"}
+}
+
+// EmbeddedLanguages returns the codes of the languages whose lists are
+// bundled into the binary, none when go generate has not been run
+func EmbeddedLanguages() []string {
+	entries, err := fs.ReadDir(bundled, "data")
+	if err != nil {
+		return nil
+	}
+	var langs []string
+	for _, entry := range entries {
+		if lang, ok := strings.CutSuffix(entry.Name(), ".txt"); ok && !entry.IsDir() {
+			langs = append(langs, lang)
+		}
+	}
+	return langs
+}
+
+// Dir returns lists stored as <lang>.txt or <lang>_50k.txt in a directory
+func Dir(path string) Source {
+	return fsSource{fsys: os.DirFS(path), dir: ".", name: "directory " + path}
+}
+
+type fsSource struct {
+	fsys fs.FS
+	dir  string
+	name string
+}
+
+func (s fsSource) Open(lang string) (io.ReadCloser, error) {
+	var lastErr error
+	for _, name := range []string{lang + ".txt", lang + "_50k.txt"} {
+		f, err := s.fsys.Open(filepath.ToSlash(filepath.Join(s.dir, name)))
+		if err == nil {
+			return f, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+func (s fsSource) OpenLanguage(lang string) (io.ReadCloser, error) {
+	return s.fsys.Open(filepath.ToSlash(filepath.Join(s.dir, lang+".lang")))
+}
+
+func (s fsSource) String() string {
+	return s.name
+}
+
+// Files returns lists stored at explicit paths, keyed by language code
+func Files(paths map[string]string) Source {
+	return fileSource(paths)
+}
+
+// ParseFiles parses a "en=/data/en.txt,sv=/data/sv.txt" specification
+func ParseFiles(spec string) (Source, error) {
+	paths := make(map[string]string)
+	for _, entry := range strings.Split(spec, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		lang, path, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid frequency file entry %q, expected lang=path", entry)
+		}
+		lang = strings.TrimSpace(lang)
+		if err := ValidateCode(lang); err != nil {
+			return nil, err
+		}
+		paths[lang] = strings.TrimSpace(path)
+	}
+	return Files(paths), nil
+}
+
+type fileSource map[string]string
+
+func (s fileSource) Open(lang string) (io.ReadCloser, error) {
+	path, ok := s[lang]
+	if !ok {
+		return nil, fmt.Errorf("no file configured for %s: %w", lang, fs.ErrNotExist)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		// A configured file that is missing is a real error, not a fallthrough
+		return nil, fmt.Errorf("%v", err)
+	}
+	return f, nil
+}
+
+// OpenLanguage opens the <lang>.lang file in the directory of the list
+func (s fileSource) OpenLanguage(lang string) (io.ReadCloser, error) {
+	path, ok := s[lang]
+	if !ok {
+		return nil, fmt.Errorf("no file configured for %s: %w", lang, fs.ErrNotExist)
+	}
+	return os.Open(filepath.Join(filepath.Dir(path), lang+".lang"))
+}
+
+func (s fileSource) String() string {
+	return "files"
+}
+
+// URL returns lists downloaded over HTTP. The template gets the language code
+// substituted twice, as in DefaultURLTemplate. Downloads are retried a few
+// times with backoff before giving up.
+func URL(template string) Source {
+	return urlSource{
+		template: template,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		attempts: 3,
+	}
+}
+
+type urlSource struct {
+	template string
+	client   *http.Client
+	attempts int
+}
+
+func (s urlSource) Open(lang string) (io.ReadCloser, error) {
+	url := fmt.Sprintf(s.template, lang, lang)
+
+	var lastErr error
+	for attempt := 1; attempt <= s.attempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(time.Duration(attempt-1) * time.Second)
+		}
+
+		resp, err := s.client.Get(url)
+		if err != nil {
+			lastErr = err
+			log.Printf("Error fetching frequency list %s (attempt %d/%d): %v", url, attempt, s.attempts, err)
+			continue
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			resp.Body.Close()
+			return nil, fmt.Errorf("%s: %w", url, fs.ErrNotExist)
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			lastErr = fmt.Errorf("%s returned status %d", url, resp.StatusCode)
+			log.Printf("Error fetching frequency list (attempt %d/%d): %v", attempt, s.attempts, lastErr)
+			continue
+		}
+		return resp.Body, nil
+	}
+
+	return nil, lastErr
+}
+
+func (s urlSource) String() string {
+	return "url " + s.template
+}
+
+// ConfiguredSources builds the source chain used by the services: explicit
+// files first, then a local directory, then the embedded lists. Downloading
+// is opt-in; url may be a template or "default" for DefaultURLTemplate.
+// Without any configured source and with no list bundled the chain could
+// not serve a single language, which is reported as an error.
+func ConfiguredSources(files, dir, url string) ([]Source, error) {
+	if files == "" && dir == "" && url == "" && len(EmbeddedLanguages()) == 0 {
+		return nil, errors.New("no frequency lists bundled: run go generate ./internal/frequency or set FREQUENCY_FILES, FREQUENCY_DIR or FREQUENCY_URL")
+	}
+	var sources []Source
+	if files != "" {
+		source, err := ParseFiles(files)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, source)
+	}
+	if dir != "" {
+		sources = append(sources, Dir(dir))
+	}
+	sources = append(sources, Embedded())
+	if url == "default" {
+		url = DefaultURLTemplate
+	}
+	if url != "" {
+		sources = append(sources, URL(url))
+	}
+	return sources, nil
+}
@@ -0,0 +1,339 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+
+	"github.com/mrconter1/codeswitch-ai/api"
+	"github.com/mrconter1/codeswitch-ai/internal/cleaner"
+	"github.com/mrconter1/codeswitch-ai/internal/document"
+	"github.com/mrconter1/codeswitch-ai/internal/experiment"
+	"github.com/mrconter1/codeswitch-ai/internal/glossary"
+	"github.com/mrconter1/codeswitch-ai/internal/guard"
+	"github.com/mrconter1/codeswitch-ai/internal/processor"
+	"github.com/mrconter1/codeswitch-ai/internal/prompt"
+	"github.com/mrconter1/codeswitch-ai/pkg/pos"
+)
+
+// article is a request being code-switched: its document, the paragraphs
+// queued for the model and what the results written back so far add up to
+type article struct {
+	g      *Gateway
+	req    api.CodeSwitchRequest
+	format document.Format
+
+	doc        document.Document
+	paragraphs []*document.Paragraph
+
+	parts       []pos.Tag
+	granularity processor.Granularity
+	policy      processor.Policy
+
+	assignments   []experiment.Assignment
+	prompts       *prompt.Set
+	model         string
+	promptVersion string
+	tolerance     float64
+	outcome       experiment.Outcome
+
+	// pending and requests are the queued paragraphs and their requests
+	pending  []pendingParagraph
+	requests []processor.Request
+
+	successCount, failCount   int
+	segments                  [][]api.Segment
+	pairs                     []api.ParagraphPair
+	achieved                  *api.Achievement
+	switchedWords, totalWords int
+	words                     *glossary.Builder
+	terms                     *terminology
+}
+
+// pendingParagraph is a paragraph waiting in a batch with its remembered
+// translations
+type pendingParagraph struct {
+	index  int
+	text   string
+	memory map[string]string
+}
+
+// processable reports whether a paragraph's text is worth sending to the
+// model; very short paragraphs are skipped
+func processable(text string) bool {
+	return len(text) >= 10
+}
+
+// newArticle assigns a request to its experiment variants and loads its
+// document
+func (g *Gateway) newArticle(ctx context.Context, req api.CodeSwitchRequest, format document.Format) (*article, error) {
+	a := &article{g: g, req: req, format: format}
+	a.parts, _ = partsOfSpeech(req.PartsOfSpeech)
+	a.granularity, _ = processor.ParseGranularity(req.Granularity)
+	a.policy, _ = processor.ParsePolicy(req.SelectionPolicy)
+
+	log.Printf("Processing %s request '%s' (%s → %s, %.1f%%)",
+		format, req.Title, req.SourceLanguage, req.TargetLanguage, req.SwitchPercent)
+
+	// Experiment variants may replace the prompt templates and the model
+	a.assignments = g.experiments.Assign(assignmentKey(req))
+	a.prompts, a.model = experiment.Overrides(a.assignments)
+	a.promptVersion = g.processor.PromptVersion()
+	if a.prompts != nil {
+		a.promptVersion = a.prompts.Version()
+	}
+	if len(a.assignments) > 0 {
+		log.Printf("Assigned to experiment variants %v", a.assignments)
+	}
+	a.tolerance = req.Tolerance
+	if a.tolerance <= 0 {
+		a.tolerance = processor.DefaultTolerance
+	}
+
+	doc, err := g.loadDocument(req)
+	if err != nil {
+		return nil, err
+	}
+	a.doc = doc
+
+	// Find all paragraphs
+	a.paragraphs = doc.Paragraphs()
+	log.Printf("Found %d paragraphs to process", len(a.paragraphs))
+
+	a.achieved = &api.Achievement{Target: req.SwitchPercent}
+	if req.Glossary {
+		a.words = glossary.NewBuilder()
+	}
+	a.terms = newTerminology()
+	return a, nil
+}
+
+// queue adds paragraph i to the paragraphs waiting for the model
+func (a *article) queue(ctx context.Context, i int) {
+	req, p := a.req, a.paragraphs[i]
+	originalText := strings.TrimSpace(p.Text)
+	log.Printf("Processing paragraph %d/%d (%d characters)", i+1, len(a.paragraphs), len(originalText))
+
+	// Translations chosen at other percentages and in earlier paragraphs
+	// keep switched words stable
+	memory := a.g.loadTranslations(ctx, a.promptVersion, req, originalText)
+	a.outcome.Paragraphs++
+
+	a.pending = append(a.pending, pendingParagraph{index: i, text: originalText, memory: memory})
+	a.requests = append(a.requests, processor.Request{
+		Text:       originalText,
+		SourceLang: req.SourceLanguage,
+		TargetLang: req.TargetLanguage,
+		Percentage: req.SwitchPercent,
+		Tolerance:  req.Tolerance,
+		Anchors:    p.Anchors,
+		Protect:    req.ProtectTerms,
+		Allow:      req.AllowTerms,
+
+		Include:       req.IncludeWords,
+		Exclude:       req.ExcludeWords,
+		PartsOfSpeech: a.parts,
+
+		Granularity: a.granularity,
+		Policy:      a.policy,
+
+		Translations: a.terms.constraints(memory),
+
+		Context:       paragraphContext(a.paragraphs, i, contextCount(req.ContextBefore), contextCount(req.ContextAfter)),
+		ContextTokens: req.ContextTokens,
+
+		Prompts: a.prompts,
+		Model:   a.model,
+	})
+}
+
+// reconcile keeps the translations of a batch consistent. Paragraphs sent
+// together could not see each other's translations as constraints, so a
+// paragraph that translated a word differently from an earlier one of the
+// batch is retried on its own with that translation fixed. Deviations left
+// after the retry are flagged when the results are recorded.
+func (a *article) reconcile(ctx context.Context, results []processor.BatchResult) []processor.BatchResult {
+	batchTerms := make(map[string]string)
+	retried := 0
+	for k, item := range a.pending {
+		result := results[k].Result
+		if results[k].Err != nil {
+			continue
+		}
+		req := a.requests[k]
+		var conflicts []string
+		for word, translation := range result.Translations {
+			expected, ok := batchTerms[word]
+			if _, fixed := req.Translations[word]; ok && !fixed && !strings.EqualFold(expected, translation) {
+				conflicts = append(conflicts, word)
+			}
+		}
+		if len(conflicts) > 0 {
+			log.Printf("Paragraph %d translated %v differently from earlier paragraphs of its batch, retrying", item.index+1, conflicts)
+			constraints := make(map[string]string, len(req.Translations)+len(batchTerms))
+			for word, translation := range batchTerms {
+				constraints[word] = translation
+			}
+			for word, translation := range req.Translations {
+				constraints[word] = translation
+			}
+			req.Translations = constraints
+			retried++
+			if retry, err := a.g.processor.Process(ctx, req); err == nil {
+				result = retry
+				results[k].Result = retry
+			} else {
+				log.Printf("Error retrying paragraph %d, keeping its batch result: %v", item.index+1, err)
+			}
+		}
+		for word, translation := range result.Translations {
+			if _, ok := batchTerms[word]; !ok {
+				batchTerms[word] = translation
+			}
+		}
+	}
+	if retried > 0 {
+		log.Printf("Retried %d of %d paragraphs of the batch for consistent terminology", retried, len(a.pending))
+	}
+	return results
+}
+
+// record writes the results of the queued paragraphs, in the order they
+// were queued, back into the document and empties the queue
+func (a *article) record(ctx context.Context, results []processor.BatchResult) {
+	req := a.req
+	for k, item := range a.pending {
+		i, p, originalText, memory := item.index, a.paragraphs[item.index], item.text, item.memory
+		result, err := results[k].Result, results[k].Err
+		if err != nil {
+			log.Printf("Error processing paragraph %d: %v", i+1, err)
+			if errors.Is(err, guard.ErrRejected) {
+				a.outcome.Checked++
+			}
+			a.failCount++
+			continue
+		}
+		a.outcome.Checked++
+		a.outcome.Passed++
+		a.outcome.Usage.Add(result.Usage)
+		a.outcome.Latency += result.Latency
+		a.g.storeTranslations(ctx, a.promptVersion, req, originalText, memory, result.Translations)
+		a.terms.record(i, result.Translations)
+
+		// Replace the original text with processed text
+		if err := writeResult(p, result, req.Output, a.doc.Format(), a.g.processor.Language(req.TargetLanguage)); err != nil {
+			log.Printf("Error replacing paragraph %d, keeping original: %v", i+1, err)
+			a.failCount++
+			continue
+		}
+		// Outputs of plain text show the paragraph without its masked markup
+		plainText, plain := document.StripPlaceholders(originalText), plainSegments(result.Segments)
+		if req.Output == outputSegments {
+			a.segments = append(a.segments, toAPISegments(plain))
+		}
+		if a.words != nil {
+			a.words.AddParagraph(plainText, plain)
+		}
+		a.achieved.Paragraphs = append(a.achieved.Paragraphs, api.ParagraphAchievement{
+			Index:    i,
+			Planned:  result.Planned,
+			Achieved: result.Achieved,
+		})
+		a.switchedWords += result.SwitchedWords
+		distance := math.Abs(result.Achieved - req.SwitchPercent)
+		a.outcome.Measured++
+		a.outcome.AbsError += distance
+		if distance <= a.tolerance {
+			a.outcome.Within++
+		}
+		a.totalWords += result.TotalWords
+		if req.Output == outputAligned || req.Output == outputAlignedTable {
+			a.pairs = append(a.pairs, alignPair(i, plainText, document.StripPlaceholders(result.Text)))
+		}
+		a.successCount++
+
+		log.Printf("Successfully processed paragraph %d", i+1)
+	}
+	a.pending, a.requests = nil, nil
+}
+
+// response renders the document with the results written back so far
+func (a *article) response(ctx context.Context) (*api.CodeSwitchResponse, error) {
+	req, format := a.req, a.format
+
+	// Render in the input format, or as a table for the aligned view
+	var rendered string
+	var err error
+	if req.Output == outputAlignedTable {
+		format = document.FormatHTML
+		rendered = alignedTable(a.pairs, a.g.processor.Language(req.SourceLanguage), a.g.processor.Language(req.TargetLanguage))
+		if req.Standalone {
+			rendered = cleaner.Standalone(documentTitle(req), a.g.processor.Language(req.SourceLanguage), rendered)
+		}
+	} else {
+		rendered, err = renderDocument(a.doc, req, a.g.processor.Language(req.SourceLanguage))
+		if err != nil {
+			return nil, fmt.Errorf("error rendering document: %v", err)
+		}
+	}
+
+	achieved := a.achieved
+	if a.totalWords > 0 {
+		achieved.Article = 100 * float64(a.switchedWords) / float64(a.totalWords)
+	}
+	log.Printf("Achieved %.1f%% switched words across the article (target %.1f%%, success: %d, failed: %d paragraphs)",
+		achieved.Article, req.SwitchPercent, a.successCount, a.failCount)
+
+	usage := a.outcome.Usage
+	log.Printf("Used %d input tokens, %d read from and %d written to the prompt cache, and %d output tokens",
+		usage.InputTokens, usage.CacheReadInputTokens, usage.CacheCreationInputTokens, usage.OutputTokens)
+
+	if len(a.terms.inconsistencies) > 0 {
+		log.Printf("%d switched words were translated inconsistently across the article", len(a.terms.inconsistencies))
+	}
+
+	response := &api.CodeSwitchResponse{
+		Format:          string(format),
+		Title:           req.Title,
+		Language:        req.TargetLanguage,
+		Segments:        a.segments,
+		Achieved:        achieved,
+		Terminology:     a.terms.terms,
+		Inconsistencies: a.terms.inconsistencies,
+		PromptVersion:   a.promptVersion,
+		Usage: &api.Usage{
+			InputTokens:              usage.InputTokens,
+			OutputTokens:             usage.OutputTokens,
+			CacheCreationInputTokens: usage.CacheCreationInputTokens,
+			CacheReadInputTokens:     usage.CacheReadInputTokens,
+		},
+	}
+	if len(a.assignments) > 0 {
+		a.g.recordExperiments(ctx, response, a.assignments, a.outcome)
+	}
+	if req.Output == outputAligned {
+		response.Pairs = a.pairs
+	}
+	if a.words != nil {
+		entries := a.words.Entries()
+		response.Glossary = toAPIGlossary(entries)
+		if id, err := a.g.storeGlossary(ctx, entries); err != nil {
+			log.Printf("Error storing glossary: %v", err)
+		} else {
+			response.GlossaryID = id
+		}
+	}
+	switch format {
+	case document.FormatHTML:
+		response.HTML = rendered
+	case document.FormatText:
+		response.Text = rendered
+	case document.FormatMarkdown:
+		response.Markdown = rendered
+	}
+
+	return response, nil
+}
@@ -0,0 +1,70 @@
+package gateway
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/mrconter1/codeswitch-ai/api"
+	"github.com/mrconter1/codeswitch-ai/internal/processor"
+)
+
+// BulkResult is the response to one request of a bulk job, or the reason
+// it failed
+type BulkResult struct {
+	Response *api.CodeSwitchResponse
+	Err      error
+}
+
+// CodeSwitchBulk code-switches many requests as one job for when latency
+// does not matter. The paragraphs of every request are sent as one message
+// batch, polled every interval, and their results are written back into
+// each document as for a single request. Remembered translations apply,
+// but terminology cannot carry over between paragraphs of the job, which
+// are all translated at once. Results are in the order of reqs. When a
+// batch failed its paragraphs are retried on their own and the error is
+// returned along with the results.
+func (g *Gateway) CodeSwitchBulk(ctx context.Context, reqs []api.CodeSwitchRequest, interval time.Duration) ([]BulkResult, error) {
+	results := make([]BulkResult, len(reqs))
+	articles := make([]*article, len(reqs))
+	var requests []processor.Request
+	for n, req := range reqs {
+		format, _, err := g.checkRequest(req)
+		if err != nil {
+			results[n].Err = err
+			continue
+		}
+		a, err := g.newArticle(ctx, req, format)
+		if err != nil {
+			results[n].Err = err
+			continue
+		}
+		for i := range a.paragraphs {
+			if processable(strings.TrimSpace(a.paragraphs[i].Text)) {
+				a.queue(ctx, i)
+			}
+		}
+		articles[n] = a
+		requests = append(requests, a.requests...)
+	}
+	log.Printf("Submitting %d paragraphs of %d requests as a bulk job", len(requests), len(reqs))
+
+	var processed []processor.BatchResult
+	var err error
+	if len(requests) > 0 {
+		processed, err = g.processor.ProcessBulk(ctx, requests, interval)
+	}
+
+	offset := 0
+	for n, a := range articles {
+		if a == nil {
+			continue
+		}
+		count := len(a.requests)
+		a.record(ctx, processed[offset:offset+count])
+		offset += count
+		results[n].Response, results[n].Err = a.response(ctx)
+	}
+	return results, err
+}
@@ -0,0 +1,111 @@
+package gateway
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/mrconter1/codeswitch-ai/api"
+	"github.com/mrconter1/codeswitch-ai/internal/experiment"
+)
+
+// assignmentKey identifies a request for splitting traffic between
+// experiment variants. It leaves out the percentage, so every level of an
+// article runs with the same variant and shares its translation memory.
+func assignmentKey(req api.CodeSwitchRequest) []byte {
+	hash := sha256.New()
+	for _, field := range []string{req.Title, req.Text, req.HTML, req.Markdown, req.SourceLanguage, req.TargetLanguage} {
+		fmt.Fprintf(hash, "%d:%s", len(field), field)
+	}
+	return hash.Sum(nil)
+}
+
+// recordExperiments tags the response with its variants and a request ID
+// for feedback, and adds the outcome to the variants' metrics
+func (g *Gateway) recordExperiments(ctx context.Context, response *api.CodeSwitchResponse, assignments []experiment.Assignment, outcome experiment.Outcome) {
+	for _, a := range assignments {
+		response.Experiments = append(response.Experiments, api.ExperimentAssignment{
+			Experiment: a.Experiment,
+			Variant:    a.Variant,
+		})
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		log.Printf("Error generating request ID: %v", err)
+		return
+	}
+	id := hex.EncodeToString(buf)
+	if err := g.metrics.Record(ctx, id, assignments, outcome); err != nil {
+		log.Printf("Error recording experiment metrics: %v", err)
+		return
+	}
+	response.RequestID = id
+}
+
+// HandleFeedback records a user's rating of a result served in an experiment
+func (g *Gateway) HandleFeedback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req api.FeedbackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.RequestID == "" || req.Rating < 1 || req.Rating > 5 {
+		http.Error(w, "requestId and a rating between 1 and 5 are required", http.StatusBadRequest)
+		return
+	}
+
+	err := g.metrics.Rate(r.Context(), req.RequestID, req.Rating)
+	switch {
+	case errors.Is(err, experiment.ErrUnknownRequest):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, fmt.Sprintf("Error recording feedback: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleExperimentReport serves the aggregated metrics of every variant of
+// the running experiments
+func (g *Gateway) HandleExperimentReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	reports, err := g.metrics.Report(r.Context(), g.experiments)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reports)
+}
+
+// AdminOnly lets requests through to next only when they carry the bearer
+// token. Without a token admin endpoints are disabled.
+func (g *Gateway) AdminOnly(token string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		given := []byte(r.Header.Get("Authorization"))
+		if token == "" || subtle.ConstantTimeCompare(given, []byte("Bearer "+token)) != 1 {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
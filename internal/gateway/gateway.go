@@ -1,51 +1,197 @@
 package gateway
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"golang.org/x/net/html"
 	"log"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/mrconter1/codeswitch-ai/api"
+	"github.com/mrconter1/codeswitch-ai/internal/cleaner"
+	"github.com/mrconter1/codeswitch-ai/internal/document"
+	"github.com/mrconter1/codeswitch-ai/internal/experiment"
+	"github.com/mrconter1/codeswitch-ai/internal/frequency"
 	"github.com/mrconter1/codeswitch-ai/internal/processor"
 	"github.com/mrconter1/codeswitch-ai/pkg/cache"
+	"github.com/mrconter1/codeswitch-ai/pkg/pos"
 )
 
 type Gateway struct {
-	cache     *cache.Cache
-	processor *processor.Processor
+	cache       *cache.Cache
+	processor   *processor.Processor
+	experiments *experiment.Config
+	metrics     *experiment.Metrics
 }
 
-func New(cache *cache.Cache, processor *processor.Processor) *Gateway {
+// New creates a gateway. experiments may be nil when none are running.
+func New(cache *cache.Cache, processor *processor.Processor, experiments *experiment.Config) *Gateway {
+	if experiments == nil {
+		experiments = &experiment.Config{}
+	}
 	return &Gateway{
-		cache:     cache,
-		processor: processor,
+		cache:       cache,
+		processor:   processor,
+		experiments: experiments,
+		metrics:     experiment.NewMetrics(cache),
+	}
+}
+
+// validateRequest checks that exactly one input is given and returns its format
+func validateRequest(req api.CodeSwitchRequest) (document.Format, error) {
+	var formats []document.Format
+	if req.Title != "" {
+		formats = append(formats, document.FormatHTML)
+	}
+	if req.HTML != "" {
+		formats = append(formats, document.FormatHTML)
+	}
+	if req.Text != "" {
+		formats = append(formats, document.FormatText)
+	}
+	if req.Markdown != "" {
+		formats = append(formats, document.FormatMarkdown)
+	}
+
+	switch {
+	case len(formats) == 0:
+		return "", fmt.Errorf("one of title, text, html or markdown is required")
+	case len(formats) > 1:
+		return "", fmt.Errorf("title, text, html and markdown are mutually exclusive")
+	case req.SourceLanguage == "" || req.TargetLanguage == "":
+		return "", fmt.Errorf("sourceLang and targetLang are required")
+	case req.SwitchPercent < 0 || req.SwitchPercent > 100:
+		return "", fmt.Errorf("percentage must be between 0 and 100")
+	case req.Tolerance < 0 || req.Tolerance > 100:
+		return "", fmt.Errorf("tolerance must be between 0 and 100")
+	case req.Standalone && formats[0] != document.FormatHTML && req.Output != outputAlignedTable:
+		return "", fmt.Errorf("standalone output requires title or html input, or the aligned-table output")
+	case frequency.ValidateCode(req.TargetLanguage) != nil:
+		return "", fmt.Errorf("invalid target language code %q", req.TargetLanguage)
+	case !outputModes[req.Output]:
+		return "", fmt.Errorf("unknown output mode %q", req.Output)
+	case !validContext(req.ContextBefore) || !validContext(req.ContextAfter):
+		return "", fmt.Errorf("contextBefore and contextAfter must be between 0 and %d", maxContextParagraphs)
+	case req.ContextTokens < 0:
+		return "", fmt.Errorf("contextTokens must not be negative")
+	}
+	if _, err := partsOfSpeech(req.PartsOfSpeech); err != nil {
+		return "", err
+	}
+	granularity, err := processor.ParseGranularity(req.Granularity)
+	if err != nil {
+		return "", err
+	}
+	policy, err := processor.ParsePolicy(req.SelectionPolicy)
+	if err != nil {
+		return "", err
+	}
+	// Phrases are overlapping runs of frequent words, which cannot be
+	// spread evenly
+	if granularity == processor.GranularityPhrase && policy == processor.PolicySpread {
+		return "", fmt.Errorf("selectionPolicy %q applies to clauses and sentences, not phrases", policy)
+	}
+
+	return formats[0], nil
+}
+
+// maxContextParagraphs bounds the neighbouring paragraphs sent as context
+const maxContextParagraphs = 5
+
+func validContext(n *int) bool {
+	return n == nil || (*n >= 0 && *n <= maxContextParagraphs)
+}
+
+// contextCount returns the requested number of context paragraphs, 1 by
+// default
+func contextCount(n *int) int {
+	if n == nil {
+		return 1
 	}
+	return *n
 }
 
-func extractTextFromNode(n *html.Node) string {
-	if n.Type == html.TextNode {
-		return n.Data
+// paragraphContext collects the heading and the non-empty neighbours of
+// paragraph i as read-only context
+func paragraphContext(paragraphs []*document.Paragraph, i, before, after int) processor.Context {
+	c := processor.Context{Heading: paragraphs[i].Heading}
+	// Placeholders of other paragraphs would read as the paragraph's own
+	plain := func(p *document.Paragraph) string {
+		return strings.TrimSpace(document.StripPlaceholders(p.Text))
 	}
-	var result string
-	for c := n.FirstChild; c != nil; c = c.NextSibling {
-		result += extractTextFromNode(c)
+	for j := i - 1; j >= 0 && len(c.Before) < before; j-- {
+		if text := plain(paragraphs[j]); text != "" {
+			c.Before = append([]string{text}, c.Before...)
+		}
+	}
+	for j := i + 1; j < len(paragraphs) && len(c.After) < after; j++ {
+		if text := plain(paragraphs[j]); text != "" {
+			c.After = append(c.After, text)
+		}
 	}
-	return result
+	return c
 }
 
-func findParagraphs(n *html.Node) []*html.Node {
-	var paragraphs []*html.Node
-	if n.Type == html.ElementNode && n.Data == "p" {
-		paragraphs = append(paragraphs, n)
+// partsOfSpeech parses the requested part-of-speech tags
+func partsOfSpeech(names []string) ([]pos.Tag, error) {
+	var tags []pos.Tag
+	for _, name := range names {
+		tag, err := pos.ParseTag(name)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+// loadDocument parses the request input, fetching and cleaning the Wikipedia
+// article when a title is given
+func (g *Gateway) loadDocument(req api.CodeSwitchRequest) (document.Document, error) {
+	switch {
+	case req.Text != "":
+		return document.ParseText(req.Text), nil
+	case req.Markdown != "":
+		return document.ParseMarkdown(req.Markdown), nil
+	}
+
+	content := req.HTML
+	if req.Title != "" {
+		// Get article from cache
+		log.Printf("Fetching article from cache: %s", req.Title)
+		article, err := g.cache.GetArticle(req.Title)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching article: %v", err)
+		}
+		log.Printf("Retrieved article: %d bytes", len(article))
+		content = article
+	}
+
+	doc, err := document.ParseHTML(content)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing HTML: %v", err)
 	}
-	for c := n.FirstChild; c != nil; c = c.NextSibling {
-		paragraphs = append(paragraphs, findParagraphs(c)...)
+
+	// Strip Wikipedia chrome before looking for paragraphs, in reader mode
+	// unless another profile is asked for. User supplied HTML is only
+	// cleaned when a profile is asked for explicitly.
+	if req.Title != "" || req.Profile != "" {
+		profile, err := cleaner.ParseProfile(req.Profile)
+		if err != nil {
+			return nil, err
+		}
+		if req.Profile == "" {
+			profile = cleaner.ProfileReader
+		}
+		if err := cleaner.Clean(doc.Root, cleaner.Options{Profile: profile}); err != nil {
+			return nil, fmt.Errorf("error cleaning HTML: %v", err)
+		}
 	}
-	return paragraphs
+
+	return doc, nil
 }
 
 func (g *Gateway) HandleCodeSwitch(w http.ResponseWriter, r *http.Request) {
@@ -63,74 +209,103 @@ func (g *Gateway) HandleCodeSwitch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("Processing request for article '%s' (%s → %s, %.1f%%)",
-		req.Title, req.SourceLanguage, req.TargetLanguage, req.SwitchPercent)
-
-	// Get article from cache
-	log.Printf("Fetching article from cache: %s", req.Title)
-	article, err := g.cache.GetArticle(req.Title)
+	format, status, err := g.checkRequest(req)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error fetching article: %v", err), http.StatusInternalServerError)
+		http.Error(w, err.Error(), status)
 		return
 	}
-	log.Printf("Retrieved article: %d bytes", len(article))
 
-	// Parse HTML
-	doc, err := html.Parse(strings.NewReader(article))
+	response, err := g.codeSwitch(r.Context(), req, format)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error parsing HTML: %v", err), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// Find all paragraphs
-	paragraphs := findParagraphs(doc)
-	log.Printf("Found %d paragraphs to process", len(paragraphs))
+	log.Printf("Request completed in %.2fs", time.Since(startTime).Seconds())
 
-	// Process each paragraph
-	successCount := 0
-	failCount := 0
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
 
-	for i, p := range paragraphs {
-		// Extract text content
-		originalText := strings.TrimSpace(extractTextFromNode(p))
-		if len(originalText) < 10 { // Skip very short paragraphs
-			continue
+// checkRequest validates a request and its source language, returning the
+// input format or the HTTP status to fail with
+func (g *Gateway) checkRequest(req api.CodeSwitchRequest) (document.Format, int, error) {
+	format, err := validateRequest(req)
+	if err != nil {
+		return "", http.StatusBadRequest, err
+	}
+	if _, err := cleaner.ParseProfile(req.Profile); err != nil {
+		return "", http.StatusBadRequest, err
+	}
+	if err := g.processor.ValidateLanguage(req.SourceLanguage); err != nil {
+		status := http.StatusServiceUnavailable
+		if errors.Is(err, frequency.ErrNoList) || errors.Is(err, frequency.ErrInvalidCode) {
+			status = http.StatusBadRequest
 		}
+		return "", status, fmt.Errorf("Unsupported source language: %v", err)
+	}
+	return format, http.StatusOK, nil
+}
 
-		log.Printf("Processing paragraph %d/%d (%d characters)", i+1, len(paragraphs), len(originalText))
+// codeSwitch processes every paragraph of the requested document and renders
+// the response
+func (g *Gateway) codeSwitch(ctx context.Context, req api.CodeSwitchRequest, format document.Format) (*api.CodeSwitchResponse, error) {
+	a, err := g.newArticle(ctx, req, format)
+	if err != nil {
+		return nil, err
+	}
 
-		// Process the paragraph
-		processed, err := g.processor.ProcessParagraph(originalText, req.SourceLanguage, req.TargetLanguage, req.SwitchPercent)
-		if err != nil {
-			log.Printf("Error processing paragraph %d: %v", i+1, err)
-			failCount++
+	// Consecutive paragraphs are sent together up to the batch budget, so
+	// terminology fixed in a batch constrains the next batches and is
+	// reconciled within the batch itself
+	budget := req.BatchTokens
+	if budget == 0 {
+		budget = processor.DefaultBatchTokens
+	}
+	batchTokens := 0
+	flush := func() {
+		a.record(ctx, a.reconcile(ctx, g.processor.ProcessBatch(ctx, a.requests, budget)))
+		batchTokens = 0
+	}
+	for i := range a.paragraphs {
+		text := strings.TrimSpace(a.paragraphs[i].Text)
+		if !processable(text) {
 			continue
 		}
+		tokens := processor.EstimateTokens(text)
+		if len(a.pending) > 0 && batchTokens+tokens > budget {
+			flush()
+		}
+		a.queue(ctx, i)
+		batchTokens += tokens
+	}
+	if len(a.pending) > 0 {
+		flush()
+	}
 
-		// Replace the original text with processed text
-		p.FirstChild.Data = processed
-		successCount++
+	return a.response(ctx)
+}
 
-		log.Printf("Successfully processed paragraph %d", i+1)
+// renderDocument renders the processed document, wrapping HTML body contents
+// in a complete page in the source language for standalone requests
+func renderDocument(doc document.Document, req api.CodeSwitchRequest, lang frequency.Language) (string, error) {
+	htmlDoc, ok := doc.(*document.HTMLDocument)
+	if !ok || !req.Standalone {
+		return doc.Render()
 	}
 
-	// Convert back to HTML string
-	var b strings.Builder
-	err = html.Render(&b, doc)
+	body, err := htmlDoc.RenderBody()
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error rendering HTML: %v", err), http.StatusInternalServerError)
-		return
+		return "", err
 	}
+	return cleaner.Standalone(documentTitle(req), lang, body), nil
+}
 
-	response := api.CodeSwitchResponse{
-		HTML:     b.String(),
-		Title:    req.Title,
-		Language: req.TargetLanguage,
+// documentTitle is the heading used for standalone output
+func documentTitle(req api.CodeSwitchRequest) string {
+	title := strings.ReplaceAll(req.Title, "_", " ")
+	if title == "" {
+		title = "Code-switched text"
 	}
-
-	log.Printf("Request completed in %.2fs (success: %d, failed: %d paragraphs)",
-		time.Since(startTime).Seconds(), successCount, failCount)
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	return title
 }
@@ -0,0 +1,95 @@
+package gateway
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/mrconter1/codeswitch-ai/api"
+	"github.com/mrconter1/codeswitch-ai/internal/glossary"
+)
+
+// glossaryTTL is how long a glossary stays available for export
+const glossaryTTL = 24 * time.Hour
+
+// storeGlossary caches a glossary for later export and returns its ID
+func (g *Gateway) storeGlossary(ctx context.Context, entries []glossary.Entry) (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("error generating glossary ID: %v", err)
+	}
+	id := hex.EncodeToString(buf)
+
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling glossary: %v", err)
+	}
+	if err := g.cache.Set(ctx, "glossary:"+id, data, glossaryTTL); err != nil {
+		return "", fmt.Errorf("error caching glossary: %v", err)
+	}
+	return id, nil
+}
+
+// HandleGlossaryExport serves a stored glossary as CSV (format=csv) or as an
+// Anki importable cloze deck (format=anki)
+func (g *Gateway) HandleGlossaryExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	format := r.URL.Query().Get("format")
+	if id == "" {
+		http.Error(w, "id is required", http.StatusBadRequest)
+		return
+	}
+
+	data, err := g.cache.Get(r.Context(), "glossary:"+id)
+	if err != nil {
+		http.Error(w, "Glossary not found", http.StatusNotFound)
+		return
+	}
+	var entries []glossary.Entry
+	if err := json.Unmarshal([]byte(data), &entries); err != nil {
+		http.Error(w, fmt.Sprintf("Error decoding glossary: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	switch format {
+	case "", "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="glossary.csv"`)
+		err = glossary.WriteCSV(w, entries)
+	case "anki":
+		w.Header().Set("Content-Type", "text/tab-separated-values; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="glossary.txt"`)
+		err = glossary.WriteAnki(w, entries)
+	default:
+		http.Error(w, fmt.Sprintf("unknown format %q", format), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Error writing glossary %s: %v", id, err)
+	}
+}
+
+func toAPIGlossary(entries []glossary.Entry) []api.GlossaryEntry {
+	result := make([]api.GlossaryEntry, len(entries))
+	for i, e := range entries {
+		result[i] = api.GlossaryEntry{
+			Source:  e.Source,
+			Targets: e.Targets,
+			Rank:    e.Rank,
+			Count:   e.Count,
+			Example: e.Example,
+			Cloze:   e.Cloze,
+		}
+	}
+	return result
+}
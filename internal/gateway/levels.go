@@ -0,0 +1,138 @@
+package gateway
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/mrconter1/codeswitch-ai/api"
+	"github.com/mrconter1/codeswitch-ai/internal/document"
+)
+
+// translationTTL is how long the translations of a paragraph's switched
+// words are remembered
+const translationTTL = 7 * 24 * time.Hour
+
+// maxLevels bounds the number of percentages in one levels request
+const maxLevels = 10
+
+// translationKey identifies a paragraph's translation memory by prompt
+// version, language pair and text, so every request for the same article
+// shares it and a prompt change starts afresh
+func translationKey(promptVersion string, req api.CodeSwitchRequest, text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return fmt.Sprintf("translations:%s:%s:%s:%s",
+		promptVersion, req.SourceLanguage, req.TargetLanguage, hex.EncodeToString(sum[:]))
+}
+
+// loadTranslations returns the remembered translations of a paragraph's
+// switched words, or nil when there are none
+func (g *Gateway) loadTranslations(ctx context.Context, promptVersion string, req api.CodeSwitchRequest, text string) map[string]string {
+	data, err := g.cache.Get(ctx, translationKey(promptVersion, req, text))
+	if err != nil {
+		return nil
+	}
+	var translations map[string]string
+	if err := json.Unmarshal([]byte(data), &translations); err != nil {
+		log.Printf("Error decoding translation memory: %v", err)
+		return nil
+	}
+	return translations
+}
+
+// storeTranslations adds newly switched words to a paragraph's translation
+// memory. Remembered translations are kept over new ones.
+func (g *Gateway) storeTranslations(ctx context.Context, promptVersion string, req api.CodeSwitchRequest, text string, memory, translations map[string]string) {
+	merged := make(map[string]string)
+	for word, translation := range translations {
+		merged[word] = translation
+	}
+	added := len(merged)
+	for word, translation := range memory {
+		if _, ok := merged[word]; ok {
+			added--
+		}
+		merged[word] = translation
+	}
+	if added == 0 {
+		return
+	}
+
+	data, err := json.Marshal(merged)
+	if err != nil {
+		log.Printf("Error encoding translation memory: %v", err)
+		return
+	}
+	if err := g.cache.Set(ctx, translationKey(promptVersion, req, text), data, translationTTL); err != nil {
+		log.Printf("Error storing translation memory: %v", err)
+	}
+}
+
+// HandleLevels code-switches a document at several percentages in one call,
+// for example for a slider. Levels are processed from the lowest up, so each
+// level switches a superset of the words of the one below and reuses their
+// translations.
+func (g *Gateway) HandleLevels(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req api.LevelsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.Levels) == 0 || len(req.Levels) > maxLevels {
+		http.Error(w, fmt.Sprintf("between 1 and %d levels are required", maxLevels), http.StatusBadRequest)
+		return
+	}
+
+	// Every level is validated before any of them spends model calls, and
+	// each distinct level is processed once
+	levels := append([]float64(nil), req.Levels...)
+	sort.Float64s(levels)
+	levels = slices.Compact(levels)
+	formats := make([]document.Format, len(levels))
+	for i, level := range levels {
+		levelReq := req.CodeSwitchRequest
+		levelReq.SwitchPercent = level
+
+		format, status, err := g.checkRequest(levelReq)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("level %g: %v", level, err), status)
+			return
+		}
+		formats[i] = format
+	}
+
+	var response api.LevelsResponse
+	for i, level := range levels {
+		levelReq := req.CodeSwitchRequest
+		levelReq.SwitchPercent = level
+
+		result, err := g.codeSwitch(r.Context(), levelReq, formats[i])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		response.Levels = append(response.Levels, api.Level{
+			Percentage:         level,
+			CodeSwitchResponse: *result,
+		})
+	}
+
+	log.Printf("Levels request (%d levels) completed in %.2fs", len(levels), time.Since(startTime).Seconds())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
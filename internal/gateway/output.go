@@ -0,0 +1,152 @@
+package gateway
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/mrconter1/codeswitch-ai/api"
+	"github.com/mrconter1/codeswitch-ai/internal/align"
+	"github.com/mrconter1/codeswitch-ai/internal/document"
+	"github.com/mrconter1/codeswitch-ai/internal/frequency"
+	"github.com/mrconter1/codeswitch-ai/internal/processor"
+)
+
+// Output modes selectable with the request's output field
+const (
+	outputPlain     = "plain"
+	outputAnnotated = "annotated"
+	outputSegments  = "segments"
+	// outputAligned returns paragraph pairs as JSON next to the plain document
+	outputAligned = "aligned"
+	// outputAlignedTable replaces the document by a two-column HTML table
+	outputAlignedTable = "aligned-table"
+)
+
+var outputModes = map[string]bool{
+	"":                 true,
+	outputPlain:        true,
+	outputAnnotated:    true,
+	outputSegments:     true,
+	outputAligned:      true,
+	outputAlignedTable: true,
+}
+
+// writeResult writes a processed paragraph back into the document in the
+// requested output mode. Plain HTML output for a right-to-left target still
+// wraps switched spans so they get the right direction.
+func writeResult(p *document.Paragraph, result *processor.Result, mode string, format document.Format, target frequency.Language) error {
+	switch {
+	case mode == outputAnnotated:
+		return p.ReplaceMarkup(annotate(result.Segments, target, true))
+	case format == document.FormatHTML && target.Direction == frequency.RTL:
+		return p.ReplaceMarkup(annotate(result.Segments, target, false))
+	}
+	return p.Replace(result.Text)
+}
+
+// annotate renders segments as HTML, wrapping every switched span in
+// <span lang="sv" data-src="the" data-rank="3">det</span>. Spans in a
+// right-to-left target get dir="rtl"; without details only lang and dir
+// are set.
+func annotate(segments []processor.Segment, target frequency.Language, details bool) string {
+	var b strings.Builder
+	for _, s := range segments {
+		if !s.Switched {
+			b.WriteString(html.EscapeString(s.Text))
+			continue
+		}
+		fmt.Fprintf(&b, `<span lang="%s"`, html.EscapeString(s.Lang))
+		if target.Direction == frequency.RTL {
+			fmt.Fprintf(&b, ` dir="%s"`, target.Direction)
+		}
+		if !details {
+			fmt.Fprintf(&b, ">%s</span>", html.EscapeString(s.Text))
+			continue
+		}
+		if s.Original != "" {
+			fmt.Fprintf(&b, ` data-src="%s"`, html.EscapeString(s.Original))
+		}
+		if s.Rank > 0 {
+			fmt.Fprintf(&b, ` data-rank="%d"`, s.Rank)
+		}
+		fmt.Fprintf(&b, ">%s</span>", html.EscapeString(s.Text))
+	}
+	return b.String()
+}
+
+// plainSegments removes the placeholders of masked markup from segments, for
+// output that shows the text without its markup. Segments left empty are
+// dropped.
+func plainSegments(segments []processor.Segment) []processor.Segment {
+	var plain []processor.Segment
+	for _, s := range segments {
+		s.Text = document.StripPlaceholders(s.Text)
+		s.Original = document.StripPlaceholders(s.Original)
+		if s.Text != "" {
+			plain = append(plain, s)
+		}
+	}
+	return plain
+}
+
+func toAPISegments(segments []processor.Segment) []api.Segment {
+	result := make([]api.Segment, len(segments))
+	for i, s := range segments {
+		result[i] = api.Segment{
+			Text:     s.Text,
+			Lang:     s.Lang,
+			Original: s.Original,
+			Rank:     s.Rank,
+		}
+	}
+	return result
+}
+
+// alignPair diffs an original paragraph against its switched version
+func alignPair(index int, original, switched string) api.ParagraphPair {
+	pair := api.ParagraphPair{Index: index, Original: original, Switched: switched}
+	for _, op := range align.Diff(original, switched) {
+		pair.Diff = append(pair.Diff, api.DiffOp{
+			Op:       string(op.Kind),
+			Original: op.Original,
+			Text:     op.Text,
+		})
+	}
+	return pair
+}
+
+// alignedTable renders paragraph pairs as a two-column table. Removed source
+// text is marked with <del> on the left, switched text with <ins> on the right.
+func alignedTable(pairs []api.ParagraphPair, source, target frequency.Language) string {
+
+	var b strings.Builder
+	b.WriteString(`<table class="codeswitch-aligned">` + "\n")
+	fmt.Fprintf(&b, "<thead><tr><th>%s</th><th>%s</th></tr></thead>\n<tbody>\n",
+		html.EscapeString(source.Code), html.EscapeString(source.Code+" → "+target.Code))
+
+	for _, pair := range pairs {
+		var left, right strings.Builder
+		for _, op := range pair.Diff {
+			switch align.Kind(op.Op) {
+			case align.Equal:
+				left.WriteString(html.EscapeString(op.Text))
+				right.WriteString(html.EscapeString(op.Text))
+			case align.Delete:
+				fmt.Fprintf(&left, "<del>%s</del>", html.EscapeString(op.Original))
+			case align.Insert:
+				fmt.Fprintf(&right, `<ins lang="%s" dir="%s">%s</ins>`,
+					html.EscapeString(target.Code), target.Direction, html.EscapeString(op.Text))
+			case align.Substitute:
+				fmt.Fprintf(&left, "<del>%s</del>", html.EscapeString(op.Original))
+				fmt.Fprintf(&right, `<ins lang="%s" dir="%s" data-src="%s">%s</ins>`,
+					html.EscapeString(target.Code), target.Direction, html.EscapeString(op.Original), html.EscapeString(op.Text))
+			}
+		}
+		fmt.Fprintf(&b, `<tr data-index="%d"><td lang="%s" dir="%s">%s</td><td dir="%s">%s</td></tr>`+"\n",
+			pair.Index, html.EscapeString(source.Code), source.Direction, left.String(), source.Direction, right.String())
+	}
+
+	b.WriteString("</tbody>\n</table>")
+	return b.String()
+}
@@ -0,0 +1,69 @@
+package gateway
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mrconter1/codeswitch-ai/internal/document"
+	"github.com/mrconter1/codeswitch-ai/internal/frequency"
+	"github.com/mrconter1/codeswitch-ai/internal/glossary"
+	"github.com/mrconter1/codeswitch-ai/internal/processor"
+)
+
+// inlineResult is the result for a paragraph with a link and bold text, with
+// "cat" switched, as the processor returns it
+func inlineResult() (*document.HTMLDocument, *document.Paragraph, *processor.Result) {
+	doc, _ := document.ParseHTML(`<p>The <a href="/wiki/Cat">cat</a> sat on the <b>mat</b>.</p>`)
+	p := doc.Paragraphs()[0]
+	result := &processor.Result{
+		Text: "The ⟦0⟧katt⟦1⟧ sat on the ⟦2⟧mat⟦3⟧.",
+		Segments: []processor.Segment{
+			{Text: "The ⟦0⟧", Lang: "en"},
+			{Text: "katt", Lang: "sv", Original: "cat", Rank: 2, Switched: true},
+			{Text: "⟦1⟧ sat on the ⟦2⟧mat⟦3⟧.", Lang: "en"},
+		},
+	}
+	return doc, p, result
+}
+
+func TestAnnotatedInlineMarkup(t *testing.T) {
+	doc, p, result := inlineResult()
+	if err := writeResult(p, result, outputAnnotated, doc.Format(), frequency.LookupLanguage("sv")); err != nil {
+		t.Fatal(err)
+	}
+	rendered, err := doc.RenderBody()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<p>The <a href="/wiki/Cat"><span lang="sv" data-src="cat" data-rank="2">katt</span></a> sat on the <b>mat</b>.</p>`
+	if rendered != want {
+		t.Errorf("rendered %s, want %s", rendered, want)
+	}
+}
+
+func TestPlainOutputsStripPlaceholders(t *testing.T) {
+	_, p, result := inlineResult()
+
+	for _, s := range toAPISegments(plainSegments(result.Segments)) {
+		if strings.ContainsAny(s.Text+s.Original, "⟦⟧") {
+			t.Errorf("segment %+v contains a placeholder", s)
+		}
+	}
+
+	words := glossary.NewBuilder()
+	words.AddParagraph(document.StripPlaceholders(p.Text), plainSegments(result.Segments))
+	entries := words.Entries()
+	if len(entries) != 1 || entries[0].Cloze != "The {{c1::katt::cat}} sat on the mat." {
+		t.Errorf("glossary entries %+v, want the cloze without placeholders", entries)
+	}
+
+	pair := alignPair(0, document.StripPlaceholders(p.Text), document.StripPlaceholders(result.Text))
+	if pair.Original != "The cat sat on the mat." || pair.Switched != "The katt sat on the mat." {
+		t.Errorf("aligned pair %q → %q still has placeholders", pair.Original, pair.Switched)
+	}
+
+	context := paragraphContext([]*document.Paragraph{p, {Text: "Next."}}, 1, 1, 0)
+	if len(context.Before) != 1 || context.Before[0] != "The cat sat on the mat." {
+		t.Errorf("context before = %q, want the text without placeholders", context.Before)
+	}
+}
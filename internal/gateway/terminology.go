@@ -0,0 +1,63 @@
+package gateway
+
+import (
+	"strings"
+
+	"github.com/mrconter1/codeswitch-ai/api"
+)
+
+// terminology is the article-wide memory of how switched words were
+// translated. Translations chosen in earlier paragraphs are passed on as
+// constraints to later ones, and paragraphs that still deviate are flagged.
+type terminology struct {
+	terms           map[string]string
+	first           map[string]int
+	inconsistencies []api.TermInconsistency
+}
+
+func newTerminology() *terminology {
+	return &terminology{
+		terms: make(map[string]string),
+		first: make(map[string]int),
+	}
+}
+
+// constraints returns the translations to fix for the next paragraph: the
+// article's terms, overridden by the paragraph's own memory from other
+// percentages
+func (t *terminology) constraints(memory map[string]string) map[string]string {
+	if len(t.terms) == 0 {
+		return memory
+	}
+	merged := make(map[string]string, len(t.terms)+len(memory))
+	for word, translation := range t.terms {
+		merged[word] = translation
+	}
+	for word, translation := range memory {
+		merged[word] = translation
+	}
+	return merged
+}
+
+// record adds the translations of a paragraph, flagging words translated
+// differently from earlier paragraphs. Case is ignored, since a word may
+// start a sentence in one paragraph and not in another.
+func (t *terminology) record(paragraph int, translations map[string]string) {
+	for word, translation := range translations {
+		expected, ok := t.terms[word]
+		if !ok {
+			t.terms[word] = translation
+			t.first[word] = paragraph
+			continue
+		}
+		if !strings.EqualFold(expected, translation) {
+			t.inconsistencies = append(t.inconsistencies, api.TermInconsistency{
+				Source:         word,
+				Expected:       expected,
+				Actual:         translation,
+				Paragraph:      paragraph,
+				FirstParagraph: t.first[word],
+			})
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package glossary
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// WriteCSV writes the glossary as CSV with a header row
+func WriteCSV(w io.Writer, entries []Entry) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"source", "targets", "rank", "count", "example"}); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		record := []string{
+			e.Source,
+			strings.Join(e.Targets, "; "),
+			strconv.Itoa(e.Rank),
+			strconv.Itoa(e.Count),
+			e.Example,
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteAnki writes the glossary as a tab separated file that Anki imports
+// as Cloze notes: the example sentence with the switched word as a cloze
+// deletion, and the source word with its other forms as extra information
+func WriteAnki(w io.Writer, entries []Entry) error {
+	header := "#separator:tab\n#html:false\n#notetype:Cloze\n#columns:Text\tExtra\n"
+	if _, err := io.WriteString(w, header); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		extra := fmt.Sprintf("%s → %s", e.Source, strings.Join(e.Targets, ", "))
+		if e.Rank > 0 {
+			extra += fmt.Sprintf(" (rank %d)", e.Rank)
+		}
+		if _, err := fmt.Fprintf(w, "%s\t%s\n", ankiField(e.Cloze), ankiField(extra)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ankiField strips the separators that would break a TSV row
+func ankiField(s string) string {
+	return strings.NewReplacer("\t", " ", "\r", " ", "\n", " ").Replace(s)
+}
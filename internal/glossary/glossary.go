@@ -0,0 +1,149 @@
+package glossary
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/mrconter1/codeswitch-ai/internal/align"
+	"github.com/mrconter1/codeswitch-ai/internal/processor"
+)
+
+// sentenceEnd matches the punctuation and whitespace that end a sentence
+var sentenceEnd = regexp.MustCompile(`[.!?]+["'”)]*\s+`)
+
+// Entry is a source word (or phrase) together with the target language forms
+// it was switched to across an article
+type Entry struct {
+	Source  string   `json:"source"`
+	Targets []string `json:"targets"`
+	Rank    int      `json:"rank"`
+	Count   int      `json:"count"`
+	Example string   `json:"example"`
+	// Cloze is Example with the switched form marked as an Anki cloze deletion
+	Cloze string `json:"cloze"`
+}
+
+// Builder collects glossary entries paragraph by paragraph
+type Builder struct {
+	entries    map[string]*Entry
+	paragraphs [][]string
+}
+
+func NewBuilder() *Builder {
+	return &Builder{entries: make(map[string]*Entry)}
+}
+
+// AddParagraph records the switched spans of a processed paragraph
+func (b *Builder) AddParagraph(original string, segments []processor.Segment) {
+	b.paragraphs = append(b.paragraphs, lowerWords(original))
+
+	var switched strings.Builder
+	for _, s := range segments {
+		start := switched.Len()
+		switched.WriteString(s.Text)
+		if !s.Switched || s.Original == "" {
+			continue
+		}
+
+		source := strings.ToLower(s.Original)
+		entry, ok := b.entries[source]
+		if !ok {
+			entry = &Entry{Source: source, Rank: s.Rank}
+			b.entries[source] = entry
+		}
+		if !contains(entry.Targets, s.Text) {
+			entry.Targets = append(entry.Targets, s.Text)
+		}
+		if entry.Example == "" {
+			entry.Example, entry.Cloze = example(segments, start, start+len(s.Text), s.Original)
+		}
+	}
+}
+
+// Entries returns the glossary ordered by frequency rank, unranked last
+func (b *Builder) Entries() []Entry {
+	entries := make([]Entry, 0, len(b.entries))
+	for _, entry := range b.entries {
+		entry.Count = b.count(entry.Source)
+		entries = append(entries, *entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		ri, rj := entries[i].Rank, entries[j].Rank
+		if (ri == 0) != (rj == 0) {
+			return rj == 0
+		}
+		if ri != rj {
+			return ri < rj
+		}
+		return entries[i].Source < entries[j].Source
+	})
+	return entries
+}
+
+// count returns how often source occurs as a word sequence in the article
+func (b *Builder) count(source string) int {
+	needle := lowerWords(source)
+	if len(needle) == 0 {
+		return 0
+	}
+
+	total := 0
+	for _, words := range b.paragraphs {
+		for i := 0; i+len(needle) <= len(words); i++ {
+			match := true
+			for j := range needle {
+				if words[i+j] != needle[j] {
+					match = false
+					break
+				}
+			}
+			if match {
+				total++
+			}
+		}
+	}
+	return total
+}
+
+// example returns the sentence of the switched paragraph that contains the
+// span [start, end), both as is and with the span as a cloze deletion
+func example(segments []processor.Segment, start, end int, original string) (string, string) {
+	var b strings.Builder
+	for _, s := range segments {
+		b.WriteString(s.Text)
+	}
+	text := b.String()
+
+	from, to := 0, len(text)
+	for _, loc := range sentenceEnd.FindAllStringIndex(text, -1) {
+		if loc[1] <= start {
+			from = loc[1]
+		} else if loc[0] >= end {
+			to = loc[1]
+			break
+		}
+	}
+
+	sentence := text[from:to]
+	cloze := text[from:start] + "{{c1::" + text[start:end] + "::" + original + "}}" + text[end:to]
+	return strings.TrimSpace(sentence), strings.TrimSpace(cloze)
+}
+
+func lowerWords(text string) []string {
+	words := align.Words(text)
+	for i, w := range words {
+		words[i] = strings.ToLower(w)
+	}
+	return words
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,122 @@
+package guard
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mrconter1/codeswitch-ai/internal/align"
+)
+
+// ErrRejected is wrapped by every error Check returns
+var ErrRejected = errors.New("model output rejected")
+
+var (
+	placeholder = regexp.MustCompile(`⟦\d+⟧`)
+	markup      = regexp.MustCompile(`</?[a-zA-Z][^<>]*>|<!--|javascript:`)
+	link        = regexp.MustCompile(`(?i)\b(?:https?://|www\.)\S+`)
+)
+
+// Limits on how far a code-switched paragraph may drift from its input.
+// Translation changes lengths, but not by this much.
+const (
+	// minLengthRatio and maxLengthRatio bound the output length in runes
+	// relative to the input, for inputs of at least minRatioLength runes
+	minLengthRatio = 0.4
+	maxLengthRatio = 2.5
+	minRatioLength = 40
+
+	// maxExcessSwitch is how many percentage points more of the input may
+	// change than was asked for
+	maxExcessSwitch = 40.0
+)
+
+// Options describe what the output was asked to be
+type Options struct {
+	// Percentage is the requested share of switched words
+	Percentage float64
+	// Nonce names the tags around article content in the prompt
+	Nonce string
+}
+
+// Check rejects a model response that deviates structurally from the
+// paragraph it was asked to code-switch: one that is empty, echoes the
+// prompt's delimiters, loses or invents placeholders, adds lines, markup or
+// links, changes length out of proportion or rewrites much more than was
+// asked. Such responses are typically the result of instructions hidden in
+// the article text.
+func Check(input, output string, opts Options) error {
+	reject := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%w: %s", ErrRejected, fmt.Sprintf(format, args...))
+	}
+
+	if strings.TrimSpace(output) == "" {
+		return reject("empty output")
+	}
+	if opts.Nonce != "" && strings.Contains(output, opts.Nonce) {
+		return reject("output contains the prompt delimiters")
+	}
+	if !sameStrings(placeholder.FindAllString(input, -1), placeholder.FindAllString(output, -1)) {
+		return reject("placeholders differ from the input")
+	}
+	if strings.Count(output, "\n") > strings.Count(input, "\n") {
+		return reject("output has more lines than the input")
+	}
+	if added := newMatches(markup, input, output); added != "" {
+		return reject("output adds markup %q", added)
+	}
+	if added := newMatches(link, input, output); added != "" {
+		return reject("output adds link %q", added)
+	}
+
+	inLen, outLen := utf8.RuneCountInString(input), utf8.RuneCountInString(output)
+	if inLen >= minRatioLength {
+		if ratio := float64(outLen) / float64(inLen); ratio < minLengthRatio || ratio > maxLengthRatio {
+			return reject("output is %.1f times the length of the input", ratio)
+		}
+	}
+
+	changed, total := 0, 0
+	for _, op := range align.Diff(input, output) {
+		words := len(align.Words(op.Original))
+		total += words
+		if op.Kind != align.Equal {
+			changed += words
+		}
+	}
+	if total > 0 {
+		if share := 100 * float64(changed) / float64(total); share > opts.Percentage+maxExcessSwitch {
+			return reject("%.0f%% of the input changed, %.0f%% was asked for", share, opts.Percentage)
+		}
+	}
+	return nil
+}
+
+// newMatches returns the first match of re in output that does not occur in
+// input, or ""
+func newMatches(re *regexp.Regexp, input, output string) string {
+	for _, m := range re.FindAllString(output, -1) {
+		if !strings.Contains(input, m) {
+			return m
+		}
+	}
+	return ""
+}
+
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,210 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/mrconter1/codeswitch-ai/internal/prompt"
+	"github.com/mrconter1/codeswitch-ai/pkg/claude"
+)
+
+// DefaultBatchTokens is the default budget of paragraph text, in estimated
+// tokens, packed into a single model call
+const DefaultBatchTokens = 1500
+
+// Output limits of a batched call, which has to hold every paragraph
+const (
+	minBatchOutputTokens = 1024
+	maxBatchOutputTokens = 4096
+)
+
+// BatchResult is the outcome of one paragraph of a batch
+type BatchResult struct {
+	Result *Result
+	Err    error
+}
+
+// EstimateTokens estimates the tokens of a paragraph for batch budgets
+func EstimateTokens(text string) int {
+	return estimateTokens(text)
+}
+
+// ProcessBatch code-switches consecutive paragraphs, packing them into as few
+// model calls as fit in budget estimated tokens of paragraph text (one call
+// per paragraph when budget is negative, DefaultBatchTokens when zero).
+// Paragraphs the model drops or mangles in a batched answer are retried with
+// a call of their own. Results are returned in the order of reqs.
+func (p *Processor) ProcessBatch(ctx context.Context, reqs []Request, budget int) []BatchResult {
+	if budget == 0 {
+		budget = DefaultBatchTokens
+	}
+	results := make([]BatchResult, len(reqs))
+
+	var group []int
+	tokens := 0
+	flush := func() {
+		p.processGroup(ctx, reqs, group, results)
+		group, tokens = nil, 0
+	}
+	for i, req := range reqs {
+		size := estimateTokens(req.Text)
+		if len(group) > 0 && (tokens+size > budget || !batchable(reqs[group[0]], req)) {
+			flush()
+		}
+		group = append(group, i)
+		tokens += size
+	}
+	if len(group) > 0 {
+		flush()
+	}
+	return results
+}
+
+// batchable reports whether two paragraphs can share a prompt
+func batchable(a, b Request) bool {
+	return a.SourceLang == b.SourceLang && a.TargetLang == b.TargetLang &&
+		a.Granularity == b.Granularity && a.Prompts == b.Prompts && a.Model == b.Model
+}
+
+// processGroup code-switches the paragraphs at the indices of group with one
+// call, falling back to single calls for what the batch did not deliver
+func (p *Processor) processGroup(ctx context.Context, reqs []Request, group []int, results []BatchResult) {
+	single := func(i int) {
+		result, err := p.Process(ctx, reqs[i])
+		results[i] = BatchResult{Result: result, Err: err}
+	}
+	if len(group) == 1 {
+		single(group[0])
+		return
+	}
+
+	var jobs []*job
+	var prepared []int
+	for _, i := range group {
+		req := reqs[i]
+		// The neighbours of paragraphs inside the batch are in the batch
+		// themselves, so only the outer context is kept
+		if i != group[0] {
+			req.Context.Before = nil
+		}
+		if i != group[len(group)-1] {
+			req.Context.After = nil
+		}
+		j, err := p.prepare(req)
+		if err != nil {
+			results[i] = BatchResult{Err: err}
+			continue
+		}
+		j.req = reqs[i]
+		jobs = append(jobs, j)
+		prepared = append(prepared, i)
+	}
+	if len(jobs) == 0 {
+		return
+	}
+
+	texts, completion, latency, err := p.completeBatch(ctx, jobs)
+	if err != nil {
+		log.Printf("Batch of %d paragraphs failed, processing them one by one: %v", len(jobs), err)
+		for _, i := range prepared {
+			single(i)
+		}
+		return
+	}
+
+	// Usage and latency of the call are shared evenly between its paragraphs
+	n := len(jobs)
+	usage := claude.Usage{
+		InputTokens:              completion.Usage.InputTokens / n,
+		OutputTokens:             completion.Usage.OutputTokens / n,
+		CacheCreationInputTokens: completion.Usage.CacheCreationInputTokens / n,
+		CacheReadInputTokens:     completion.Usage.CacheReadInputTokens / n,
+	}
+	retried := 0
+	for k, i := range prepared {
+		if texts[k] != "" {
+			result, err := p.finish(jobs[k], texts[k], completion.Model, usage, latency/time.Duration(n))
+			if err == nil {
+				results[i] = BatchResult{Result: result}
+				continue
+			}
+			log.Printf("Batched paragraph %d rejected: %v", k+1, err)
+		}
+		retried++
+		single(i)
+	}
+	log.Printf("Processed %d paragraphs in one call, %d retried on their own", n, retried)
+}
+
+// BatchPrompt renders one prompt for the paragraphs of batch, which share
+// languages, granularity and templates, with the options to send it with.
+// The answer holds every paragraph, so its token limit grows with theirs.
+func BatchPrompt(prompts *prompt.Set, batch prompt.Batch, model string) (string, claude.Options, error) {
+	outputTokens := 0
+	for _, item := range batch.Items {
+		outputTokens += 2 * estimateTokens(item.Paragraph)
+	}
+	promptText, err := prompts.RenderBatch(batch)
+	if err != nil {
+		return "", claude.Options{}, err
+	}
+	system, err := prompts.System(prompt.Data{
+		Nonce:      batch.Nonce,
+		Batch:      true,
+		SourceLang: batch.SourceLang,
+		TargetLang: batch.TargetLang,
+	})
+	if err != nil {
+		return "", claude.Options{}, err
+	}
+	instructions, err := prompts.Instructions("batch", batch)
+	if err != nil {
+		return "", claude.Options{}, err
+	}
+	return promptText, claude.Options{
+		Model:     model,
+		System:    claude.Prefix(system, instructions),
+		MaxTokens: min(max(outputTokens, minBatchOutputTokens), maxBatchOutputTokens),
+	}, nil
+}
+
+// completeBatch renders one prompt for the jobs, which share languages,
+// granularity, templates and model, and splits the answer per job
+func (p *Processor) completeBatch(ctx context.Context, jobs []*job) ([]string, *claude.Completion, time.Duration, error) {
+	first := jobs[0]
+	batch := prompt.Batch{
+		Nonce:       prompt.NewNonce(),
+		SourceLang:  first.req.SourceLang,
+		TargetLang:  first.req.TargetLang,
+		Granularity: first.template,
+		Examples:    first.data.Examples,
+	}
+	for _, j := range jobs {
+		batch.Items = append(batch.Items, j.data)
+	}
+	promptText, opts, err := BatchPrompt(first.prompts, batch, first.req.Model)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	for _, j := range jobs {
+		j.data.Nonce = batch.Nonce
+	}
+	log.Printf("Created batch prompt (version %s) for %d paragraphs", first.prompts.Version(), len(jobs))
+
+	p.checkPrefix(first.prompts, "batch", opts)
+	completion, latency, err := p.complete(ctx, promptText, opts)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	// An answer cut off at the token limit lacks the closing tag of its last
+	// paragraph, which is then retried like any other missing one
+	texts := prompt.ParseBatch(completion.Text, batch.Nonce, len(jobs))
+	for _, text := range texts {
+		if text != "" {
+			return texts, completion, latency, nil
+		}
+	}
+	return nil, nil, 0, errors.New("no paragraph could be read from the answer")
+}
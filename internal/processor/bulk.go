@@ -0,0 +1,139 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/mrconter1/codeswitch-ai/pkg/claude"
+)
+
+// DefaultPollInterval is how often ProcessBulk checks whether a message
+// batch has ended when no interval is given
+const DefaultPollInterval = time.Minute
+
+// bulkChunkSize is how many requests ProcessBulk puts in one message batch
+var bulkChunkSize = claude.MaxBatchRequests
+
+// ProcessBulk code-switches paragraphs through the Message Batches API,
+// which answers within a day at a lower price than single calls. Every
+// paragraph becomes one request of a message batch (several batches beyond
+// claude.MaxBatchRequests), polled every interval until it has ended.
+// Paragraphs that errored, expired or fail the output checks, and those of
+// a batch that could not be submitted or followed, are retried with a call
+// of their own. Results are returned in the order of reqs and carry no
+// latency. They are returned even with an error, which reports the batches
+// that failed, so paragraphs already answered are not lost.
+func (p *Processor) ProcessBulk(ctx context.Context, reqs []Request, interval time.Duration) ([]BatchResult, error) {
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	results := make([]BatchResult, len(reqs))
+	jobs := make([]*job, len(reqs))
+	ids := make(map[string]int)
+	var batchReqs []claude.BatchRequest
+	for i, req := range reqs {
+		j, err := p.prepare(req)
+		if err != nil {
+			results[i] = BatchResult{Err: err}
+			continue
+		}
+		promptText, opts, err := p.render(j)
+		if err != nil {
+			results[i] = BatchResult{Err: err}
+			continue
+		}
+		id := fmt.Sprintf("paragraph-%d", i)
+		jobs[i] = j
+		ids[id] = i
+		batchReqs = append(batchReqs, claude.BatchRequest{CustomID: id, Prompt: promptText, Options: opts})
+	}
+
+	done := make([]bool, len(reqs))
+	var errs []error
+	for start := 0; start < len(batchReqs); start += bulkChunkSize {
+		chunk := batchReqs[start:min(start+bulkChunkSize, len(batchReqs))]
+		err := p.runBatch(ctx, chunk, interval, func(result claude.BatchResult) {
+			i, ok := ids[result.CustomID]
+			if !ok || done[i] {
+				log.Printf("Ignoring unexpected batch result %q", result.CustomID)
+				return
+			}
+			if result.Err != nil {
+				log.Printf("Batch request for paragraph %d failed: %v", i+1, result.Err)
+				return
+			}
+			completion := result.Completion
+			res, err := p.finish(jobs[i], completion.Text, completion.Model, completion.Usage, 0)
+			if err != nil {
+				log.Printf("Batch result for paragraph %d rejected: %v", i+1, err)
+				return
+			}
+			results[i] = BatchResult{Result: res}
+			done[i] = true
+		})
+		if err != nil {
+			// Paragraphs of the batch without a result are retried below
+			log.Printf("Message batch of %d requests failed: %v", len(chunk), err)
+			errs = append(errs, err)
+			if ctx.Err() != nil {
+				break
+			}
+		}
+	}
+
+	retried := 0
+	for i, j := range jobs {
+		if j == nil || done[i] {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			results[i] = BatchResult{Err: err}
+			continue
+		}
+		retried++
+		result, err := p.Process(ctx, reqs[i])
+		results[i] = BatchResult{Result: result, Err: err}
+	}
+	log.Printf("Processed %d paragraphs in message batches, %d retried on their own", len(batchReqs), retried)
+	return results, errors.Join(errs...)
+}
+
+// runBatch submits one message batch, waits for it to end and hands every
+// result to fn
+func (p *Processor) runBatch(ctx context.Context, reqs []claude.BatchRequest, interval time.Duration, fn func(claude.BatchResult)) error {
+	// Wait for rate limiter
+	<-p.rateLimiter
+
+	batch, err := p.claudeClient.CreateBatch(ctx, reqs)
+	if err != nil {
+		return fmt.Errorf("error creating message batch: %v", err)
+	}
+	log.Printf("Submitted message batch %s with %d requests", batch.ID, len(reqs))
+
+	id := batch.ID
+	batch, err = p.claudeClient.WaitBatch(ctx, id, interval)
+	if err != nil {
+		return fmt.Errorf("error waiting for message batch %s: %v", id, err)
+	}
+	counts := batch.RequestCounts
+	log.Printf("Message batch %s ended: %d succeeded, %d errored, %d canceled, %d expired",
+		batch.ID, counts.Succeeded, counts.Errored, counts.Canceled, counts.Expired)
+
+	var usage claude.Usage
+	err = p.claudeClient.BatchResults(ctx, batch, func(result claude.BatchResult) error {
+		if result.Completion != nil {
+			usage.Add(result.Completion.Usage)
+		}
+		fn(result)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error reading results of message batch %s: %v", batch.ID, err)
+	}
+	log.Printf("Message batch %s used %d input tokens (%d read from and %d written to the prompt cache) and %d output tokens",
+		batch.ID, usage.InputTokens, usage.CacheReadInputTokens, usage.CacheCreationInputTokens, usage.OutputTokens)
+	return nil
+}
@@ -0,0 +1,123 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mrconter1/codeswitch-ai/internal/frequency"
+	"github.com/mrconter1/codeswitch-ai/pkg/claude"
+	"github.com/mrconter1/codeswitch-ai/pkg/claude/fake"
+)
+
+// newBulkProcessor returns a processor for English paragraphs talking to a
+// fake API
+func newBulkProcessor(t *testing.T) (*Processor, *fake.Server) {
+	t.Helper()
+	dir := t.TempDir()
+	words := "the 1000\nof 900\nand 800\nto 700\nin 600\na 500\nis 400\nwas 300\nriver 200\ntown 100\n"
+	if err := os.WriteFile(filepath.Join(dir, "en.txt"), []byte(words), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	server := fake.NewServer()
+	t.Cleanup(server.Close)
+	server.Polls = 0
+	client := claude.NewWithBaseURL("test", server.URL())
+	return New(client, frequency.NewRegistry(frequency.Dir(dir)), nil, nil, nil), server
+}
+
+func bulkRequest(text, sourceLang string) Request {
+	return Request{Text: text, SourceLang: sourceLang, TargetLang: "sv", Percentage: 20}
+}
+
+func TestProcessBulk(t *testing.T) {
+	p, server := newBulkProcessor(t)
+	server.Fail = func(prompt string) bool { return strings.Contains(prompt, "flooded") }
+
+	reqs := []Request{
+		bulkRequest("The town was built along the river.", "en"),
+		bulkRequest("The river flooded the town in the spring.", "en"),
+		bulkRequest("A bridge is in the middle of the town.", "xx"),
+		bulkRequest("The old mill was the heart of the town.", "en"),
+	}
+	results, err := p.ProcessBulk(context.Background(), reqs, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(reqs) {
+		t.Fatalf("got %d results for %d requests", len(results), len(reqs))
+	}
+
+	// The fake API returns results last first and echoes every paragraph
+	for _, i := range []int{0, 3} {
+		if results[i].Err != nil || results[i].Result == nil || results[i].Result.Text != reqs[i].Text {
+			t.Errorf("result %d = %+v, want the text of request %d", i, results[i], i)
+		}
+	}
+	// Failed in the batch and again on its own
+	if results[1].Err == nil {
+		t.Errorf("result 1 = %+v, want the error of the failed request", results[1])
+	}
+	// Never submitted, as there is no frequency list
+	if results[2].Err == nil || !strings.Contains(results[2].Err.Error(), "frequency") {
+		t.Errorf("result 2 = %+v, want a frequency data error", results[2])
+	}
+}
+
+func TestProcessBulkFailedChunk(t *testing.T) {
+	p, server := newBulkProcessor(t)
+	bulkChunkSize = 2
+	t.Cleanup(func() { bulkChunkSize = claude.MaxBatchRequests })
+	server.RejectBatch = func(ids []string) bool { return slices.Contains(ids, "paragraph-2") }
+
+	reqs := []Request{
+		bulkRequest("The town was built along the river.", "en"),
+		bulkRequest("The river flooded the town in the spring.", "en"),
+		bulkRequest("A bridge is in the middle of the town.", "en"),
+		bulkRequest("The old mill was the heart of the town.", "en"),
+	}
+	results, err := p.ProcessBulk(context.Background(), reqs, time.Millisecond)
+	if err == nil {
+		t.Error("failed batch not reported")
+	}
+	if len(results) != len(reqs) {
+		t.Fatalf("got %d results for %d requests", len(results), len(reqs))
+	}
+	// The first batch succeeded, the paragraphs of the second were retried
+	for i, result := range results {
+		if result.Err != nil || result.Result == nil || result.Result.Text != reqs[i].Text {
+			t.Errorf("result %d = %+v, want the text of request %d", i, result, i)
+		}
+	}
+}
+
+func TestProcessBulkCanceled(t *testing.T) {
+	p, server := newBulkProcessor(t)
+	server.Polls = 1 << 20
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		// Cancel once the batch has been submitted and is being waited for
+		client := claude.NewWithBaseURL("test", server.URL())
+		for {
+			if _, err := client.GetBatch(context.Background(), "msgbatch_fake1"); err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		cancel()
+	}()
+	reqs := []Request{bulkRequest("The town was built along the river.", "en")}
+	results, err := p.ProcessBulk(ctx, reqs, 10*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), context.Canceled.Error()) {
+		t.Errorf("ProcessBulk after cancel = %v, %v, want a cancellation error", results, err)
+	}
+	if len(results) != 1 || !errors.Is(results[0].Err, context.Canceled) {
+		t.Errorf("results after cancel = %+v, want the cancellation for every paragraph", results)
+	}
+}
@@ -0,0 +1,92 @@
+package processor
+
+import "strings"
+
+// DefaultContextTokens is the default token budget for a paragraph and its
+// surrounding context together
+const DefaultContextTokens = 2000
+
+// Context is text around a paragraph that the model may read but must not
+// translate: the section heading and the neighbouring paragraphs. Before is
+// ordered as in the document, so its last entry is the nearest.
+type Context struct {
+	Heading string
+	Before  []string
+	After   []string
+}
+
+// estimateTokens approximates the tokens of text at four bytes per token
+func estimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// fit trims the context to what is left of budget after the paragraph.
+// Neighbours are added nearest first, alternating sides; the first one that
+// does not fit is cut at a word boundary, keeping the part next to the
+// paragraph, and farther ones are dropped. A long paragraph thus loses its
+// context before anything else.
+func (c Context) fit(paragraph string, budget int) Context {
+	if budget <= 0 {
+		budget = DefaultContextTokens
+	}
+	left := budget - estimateTokens(paragraph)
+
+	var fitted Context
+	if tokens := estimateTokens(c.Heading); tokens <= left {
+		fitted.Heading = c.Heading
+		left -= tokens
+	}
+
+	before, after := len(c.Before)-1, 0
+	for left > 0 && (before >= 0 || after < len(c.After)) {
+		if before >= 0 {
+			text := c.Before[before]
+			if tokens := estimateTokens(text); tokens > left {
+				text = tail(text, left*4)
+				before = -1
+			} else {
+				before--
+			}
+			if text != "" {
+				fitted.Before = append([]string{text}, fitted.Before...)
+				left -= estimateTokens(text)
+			}
+		}
+		if after < len(c.After) && left > 0 {
+			text := c.After[after]
+			if tokens := estimateTokens(text); tokens > left {
+				text = head(text, left*4)
+				after = len(c.After)
+			} else {
+				after++
+			}
+			if text != "" {
+				fitted.After = append(fitted.After, text)
+				left -= estimateTokens(text)
+			}
+		}
+	}
+	return fitted
+}
+
+// head returns at most n bytes from the start of text, cut at a space
+func head(text string, n int) string {
+	if len(text) <= n {
+		return text
+	}
+	if i := strings.LastIndex(text[:n], " "); i > 0 {
+		return text[:i] + " …"
+	}
+	return ""
+}
+
+// tail returns at most n bytes from the end of text, cut at a space
+func tail(text string, n int) string {
+	if len(text) <= n {
+		return text
+	}
+	if i := strings.Index(text[len(text)-n:], " "); i >= 0 {
+		return "… " + text[len(text)-n+i+1:]
+	}
+	return ""
+}
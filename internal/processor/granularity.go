@@ -0,0 +1,268 @@
+package processor
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/mrconter1/codeswitch-ai/internal/frequency"
+	"github.com/mrconter1/codeswitch-ai/pkg/pos"
+	"github.com/mrconter1/codeswitch-ai/pkg/tokenizer"
+)
+
+// Granularity is the size of the spans that are switched. Word switching
+// inserts single target words into source sentences (insertional switching);
+// clause and sentence switching alternate between the languages at
+// syntactic boundaries (alternational switching).
+type Granularity string
+
+const (
+	GranularityWord     Granularity = "word"
+	GranularityPhrase   Granularity = "phrase"
+	GranularityClause   Granularity = "clause"
+	GranularitySentence Granularity = "sentence"
+)
+
+// Policy decides which clauses or sentences are switched first
+type Policy string
+
+const (
+	// PolicyEasiest switches the units made of the most frequent words first
+	PolicyEasiest Policy = "easiest"
+	// PolicySpread spreads the switched units evenly over the paragraph
+	PolicySpread Policy = "spread"
+)
+
+// ParseGranularity parses a granularity name; empty means word
+func ParseGranularity(name string) (Granularity, error) {
+	switch g := Granularity(name); g {
+	case "":
+		return GranularityWord, nil
+	case GranularityWord, GranularityPhrase, GranularityClause, GranularitySentence:
+		return g, nil
+	}
+	return "", fmt.Errorf("unknown granularity %q", name)
+}
+
+// ParsePolicy parses a selection policy name; empty means easiest
+func ParsePolicy(name string) (Policy, error) {
+	switch p := Policy(name); p {
+	case "":
+		return PolicyEasiest, nil
+	case PolicyEasiest, PolicySpread:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown selection policy %q", name)
+}
+
+// maxPhraseWords is the longest n-gram considered a phrase
+const maxPhraseWords = 3
+
+// unit is a span of the paragraph switched as a whole
+type unit struct {
+	start, end int
+	words      int
+	score      float64
+}
+
+// selectUnits picks the phrases, clauses or sentences to switch so that the
+// share of words they cover is as close as possible to the target, and
+// returns their texts in order of appearance with the planned share
+func selectUnits(list *frequency.List, candidates selection, tagger *pos.Tagger, granularity Granularity, policy Policy, text string, target float64) ([]string, float64) {
+	var units []unit
+	switch granularity {
+	case GranularityPhrase:
+		units = phraseUnits(candidates, text)
+	case GranularityClause:
+		units = clauseUnits(list, candidates, tagger, text)
+	default:
+		units = sentenceUnits(list, candidates, text)
+	}
+
+	order := make([]int, len(units))
+	for i := range order {
+		order[i] = i
+	}
+	if policy == PolicySpread {
+		sort.SliceStable(order, func(a, b int) bool {
+			return radicalInverse(order[a]) < radicalInverse(order[b])
+		})
+	} else {
+		sort.SliceStable(order, func(a, b int) bool {
+			ua, ub := units[order[a]], units[order[b]]
+			if ua.score != ub.score {
+				return ua.score < ub.score
+			}
+			return ua.words > ub.words
+		})
+	}
+
+	total := len(candidates.tokens)
+	if total == 0 {
+		return nil, 0
+	}
+	var chosen []unit
+	covered := make([]bool, len(text))
+	words := 0
+	for _, i := range order {
+		u := units[i]
+		if overlaps(covered, u) {
+			continue
+		}
+		before := 100 * float64(words) / float64(total)
+		after := 100 * float64(words+u.words) / float64(total)
+		if math.Abs(after-target) >= math.Abs(before-target) {
+			// Stopping at the first unit that does not help keeps the
+			// selection for a lower target a prefix of a higher one
+			break
+		}
+		chosen = append(chosen, u)
+		words += u.words
+		for j := u.start; j < u.end; j++ {
+			covered[j] = true
+		}
+	}
+
+	sort.Slice(chosen, func(a, b int) bool { return chosen[a].start < chosen[b].start })
+	texts := make([]string, len(chosen))
+	for i, u := range chosen {
+		texts[i] = text[u.start:u.end]
+	}
+	planned := 100 * float64(words) / float64(total)
+	log.Printf("Selected %d of %d %s units, planned to switch %.1f%% of this paragraph",
+		len(chosen), len(units), granularity, planned)
+	return texts, planned
+}
+
+func overlaps(covered []bool, u unit) bool {
+	for j := u.start; j < u.end; j++ {
+		if covered[j] {
+			return true
+		}
+	}
+	return false
+}
+
+// radicalInverse mirrors the binary digits of i+1 around the point (0, 1,
+// 2 → 0.5, 0.25, 0.75), so that any prefix of units ordered by it is spread
+// evenly
+func radicalInverse(i int) float64 {
+	inverse, f := 0.0, 0.5
+	for i++; i > 0; i >>= 1 {
+		inverse += f * float64(i&1)
+		f /= 2
+	}
+	return inverse
+}
+
+// phraseUnits returns every run of two to maxPhraseWords switchable words
+// separated only by spaces, scored by the rank of their rarest word
+func phraseUnits(candidates selection, text string) []unit {
+	var units []unit
+	tokens := candidates.tokens
+	for i := range tokens {
+		worst := 0
+		for n := 1; n <= maxPhraseWords && i+n <= len(tokens); n++ {
+			last := i + n - 1
+			if candidates.ranks[last] == 0 {
+				break
+			}
+			if n > 1 && strings.TrimSpace(text[tokens[last-1].End:tokens[last].Start]) != "" {
+				break
+			}
+			worst = max(worst, candidates.ranks[last])
+			if n > 1 {
+				units = append(units, unit{
+					start: tokens[i].Start,
+					end:   tokens[last].End,
+					words: n,
+					score: float64(worst),
+				})
+			}
+		}
+	}
+	return units
+}
+
+// sentenceUnits splits text into sentences at terminal punctuation
+func sentenceUnits(list *frequency.List, candidates selection, text string) []unit {
+	return boundaryUnits(list, candidates, text, ".!?", nil)
+}
+
+// clauseUnits splits sentences further at clause punctuation and, when a
+// tagger is available, before conjunctions
+func clauseUnits(list *frequency.List, candidates selection, tagger *pos.Tagger, text string) []unit {
+	var conj map[int]bool
+	if tagger != nil {
+		words := make([]string, len(candidates.tokens))
+		for i, t := range candidates.tokens {
+			words[i] = t.Normalized()
+		}
+		conj = make(map[int]bool)
+		for i, tag := range tagger.Tag(words, nil) {
+			if tag == pos.Conj {
+				conj[candidates.tokens[i].Start] = true
+			}
+		}
+	}
+	return boundaryUnits(list, candidates, text, ".!?,;:—–", conj)
+}
+
+// boundaryUnits splits text after punctuation in breaks and before words
+// starting at an offset in before. Units shorter than two words are merged
+// into the previous one.
+func boundaryUnits(list *frequency.List, candidates selection, text, breaks string, before map[int]bool) []unit {
+	var bounds []int
+	for _, t := range tokenizer.Tokenize(text) {
+		switch {
+		case t.Kind == tokenizer.Punct && strings.ContainsAny(t.Text, breaks):
+			bounds = append(bounds, t.End)
+		case t.Kind == tokenizer.Word && before[t.Start]:
+			bounds = append(bounds, t.Start)
+		}
+	}
+	bounds = append(bounds, len(text))
+
+	var units []unit
+	start := 0
+	for _, end := range bounds {
+		u := newUnit(list, candidates, text, start, end)
+		switch {
+		case u.words == 0:
+		case u.words < 2 && len(units) > 0:
+			units[len(units)-1] = newUnit(list, candidates, text, units[len(units)-1].start, u.end)
+		default:
+			units = append(units, u)
+		}
+		start = end
+	}
+	return units
+}
+
+// newUnit trims the span [start, end) of text and scores it by the mean rank
+// of its words; words that may not be switched count as the rarest
+func newUnit(list *frequency.List, candidates selection, text string, start, end int) unit {
+	span := text[start:end]
+	start += len(span) - len(strings.TrimLeft(span, " \t\n"))
+	end -= len(span) - len(strings.TrimRight(span, " \t\n"))
+
+	u := unit{start: start, end: end}
+	sum := 0.0
+	for i, t := range candidates.tokens {
+		if t.Start < start || t.End > end {
+			continue
+		}
+		u.words++
+		if rank := candidates.ranks[i]; rank != 0 {
+			sum += float64(max(rank, 1))
+		} else {
+			sum += float64(list.Len() + 1)
+		}
+	}
+	if u.words > 0 {
+		u.score = sum / float64(u.words)
+	}
+	return u
+}
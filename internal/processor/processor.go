@@ -1,237 +1,556 @@
 package processor
 
 import (
-	"bufio"
 	"context"
 	"fmt"
 	"log"
-	"net/http"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/mrconter1/codeswitch-ai/internal/align"
+	"github.com/mrconter1/codeswitch-ai/internal/document"
+	"github.com/mrconter1/codeswitch-ai/internal/entity"
+	"github.com/mrconter1/codeswitch-ai/internal/frequency"
+	"github.com/mrconter1/codeswitch-ai/internal/guard"
+	"github.com/mrconter1/codeswitch-ai/internal/prompt"
 	"github.com/mrconter1/codeswitch-ai/pkg/claude"
+	"github.com/mrconter1/codeswitch-ai/pkg/lemma"
+	"github.com/mrconter1/codeswitch-ai/pkg/pos"
+	"github.com/mrconter1/codeswitch-ai/pkg/tokenizer"
 )
 
-type WordFrequency struct {
-	word  string
-	count int
+type Processor struct {
+	claudeClient *claude.Client
+	rateLimiter  <-chan time.Time
+	frequencies  *frequency.Registry
+	lemmas       *lemma.Registry
+	taggers      *pos.Registry
+	prompts      *prompt.Set
+
+	// uncached holds the prompts whose system prefix was found too short
+	// for prompt caching, so that is logged once per prompt
+	uncached sync.Map
 }
 
-type Processor struct {
-	claudeClient    *claude.Client
-	rateLimiter     <-chan time.Time
-	enWordFreqs     []WordFrequency
-	svWordFreqs     []WordFrequency
-	frequencyLoader sync.Once
+// Request describes a single paragraph to code-switch
+type Request struct {
+	Text       string
+	SourceLang string
+	TargetLang string
+	Percentage float64
+	// Tolerance is the allowed distance in percentage points between the
+	// requested and the planned share of switched tokens
+	Tolerance float64
+
+	// Anchors are the link texts of the paragraph, used to recognize names.
+	// Protect terms are never switched; Allow terms are never taken for names.
+	Anchors []string
+	Protect []string
+	Allow   []string
+
+	// Include words are always switched and Exclude words never, matched
+	// on the word or its lemma. PartsOfSpeech, when set, limits switching to
+	// words tagged with one of them.
+	Include       []string
+	Exclude       []string
+	PartsOfSpeech []pos.Tag
+
+	// Granularity is the size of the switched spans, word by default.
+	// Policy decides which clauses or sentences are switched.
+	Granularity Granularity
+	Policy      Policy
+
+	// Translations fixes the translation of words switched before, for
+	// example at a lower percentage, so they read the same everywhere
+	Translations map[string]string
+
+	// Context is shown to the model as read-only text, trimmed so that the
+	// paragraph and its context fit in ContextTokens (DefaultContextTokens
+	// when zero)
+	Context       Context
+	ContextTokens int
+
+	// Prompts and Model override the processor's prompt templates and the
+	// default model, for example for an experiment variant
+	Prompts *prompt.Set
+	Model   string
+}
+
+// Result is a code-switched paragraph along with the spans that changed.
+// Planned is the percentage of tokens selected for switching; Achieved is the
+// percentage of source words that actually changed in the output.
+type Result struct {
+	Text     string
+	Words    []string
+	Segments []Segment
+
+	Planned       float64
+	Achieved      float64
+	SwitchedWords int
+	TotalWords    int
+
+	// Translations maps each switched word to the text that replaced it
+	Translations map[string]string
+
+	// PromptVersion identifies the prompt templates the result came from
+	PromptVersion string
+
+	// Model is the model that wrote the result, Usage its token usage and
+	// Latency how long the model took to respond
+	Model   string
+	Usage   claude.Usage
+	Latency time.Duration
+}
+
+// Segment is a contiguous span of the code-switched paragraph. Switched
+// segments carry the target language, the source text they replaced and the
+// frequency rank of that source text.
+type Segment struct {
+	Text     string
+	Lang     string
+	Original string
+	Rank     int
+	Switched bool
 }
 
-func New(claudeClient *claude.Client) *Processor {
+// New creates a processor. lemmas may be nil to match words on their surface
+// form only, taggers nil to ignore part-of-speech targeting and prompts nil
+// to use the bundled prompt templates.
+func New(claudeClient *claude.Client, frequencies *frequency.Registry, lemmas *lemma.Registry, taggers *pos.Registry, prompts *prompt.Set) *Processor {
+	if prompts == nil {
+		prompts = prompt.Default()
+	}
 	return &Processor{
 		claudeClient: claudeClient,
 		rateLimiter:  time.Tick(time.Second),
+		frequencies:  frequencies,
+		lemmas:       lemmas,
+		taggers:      taggers,
+		prompts:      prompts,
 	}
 }
 
-// loadFrequencyData loads word frequency data from GitHub
-func (p *Processor) loadFrequencyData() error {
-	p.frequencyLoader.Do(func() {
-		log.Println("Loading frequency dictionaries...")
+// PromptVersion identifies the prompt templates in use, for keying cached
+// outputs
+func (p *Processor) PromptVersion() string {
+	return p.prompts.Version()
+}
 
-		// Load English frequencies
-		enResp, err := http.Get("https://raw.githubusercontent.com/hermitdave/FrequencyWords/master/content/2018/en/en_50k.txt")
-		if err != nil {
-			log.Printf("Error loading English frequencies: %v", err)
-			return
-		}
-		defer enResp.Body.Close()
-
-		scanner := bufio.NewScanner(enResp.Body)
-		for scanner.Scan() {
-			parts := strings.Fields(scanner.Text())
-			if len(parts) == 2 {
-				count := 0
-				fmt.Sscanf(parts[1], "%d", &count)
-				p.enWordFreqs = append(p.enWordFreqs, WordFrequency{
-					word:  parts[0],
-					count: count,
-				})
-			}
-		}
+// Language returns the writing system of a language
+func (p *Processor) Language(code string) frequency.Language {
+	return p.frequencies.Language(code)
+}
 
-		// Load Swedish frequencies
-		svResp, err := http.Get("https://raw.githubusercontent.com/hermitdave/FrequencyWords/master/content/2018/sv/sv_50k.txt")
-		if err != nil {
-			log.Printf("Error loading Swedish frequencies: %v", err)
-			return
-		}
-		defer svResp.Body.Close()
-
-		scanner = bufio.NewScanner(svResp.Body)
-		for scanner.Scan() {
-			parts := strings.Fields(scanner.Text())
-			if len(parts) == 2 {
-				count := 0
-				fmt.Sscanf(parts[1], "%d", &count)
-				p.svWordFreqs = append(p.svWordFreqs, WordFrequency{
-					word:  parts[0],
-					count: count,
-				})
-			}
-		}
+// ValidateLanguage checks that a frequency list is available for lang, so
+// it can be used as a source language
+func (p *Processor) ValidateLanguage(lang string) error {
+	_, err := p.frequencies.Get(lang)
+	return err
+}
 
-		log.Printf("Loaded %d English words and %d Swedish words",
-			len(p.enWordFreqs), len(p.svWordFreqs))
-	})
+// calculateWordsNeeded returns how many top frequency words we need to
+// translate to achieve the desired percentage, using the cumulative corpus
+// counts of the source language's list
+func (p *Processor) calculateWordsNeeded(list *frequency.List, percentage float64) int {
+	return list.Coverage().RankFor(percentage / 100.0)
+}
 
-	return nil
+// lemmatizer returns the lemmatizer of a language, or nil when there is none
+func (p *Processor) lemmatizer(lang string) lemma.Lemmatizer {
+	if p.lemmas == nil {
+		return nil
+	}
+	return p.lemmas.Get(lang)
 }
 
-// calculateWordsNeeded uses Zipf's law to estimate how many top frequency words
-// we need to translate to achieve the desired percentage
-func (p *Processor) calculateWordsNeeded(percentage float64) int {
-	// Simple Zipf's law implementation
-	// In a natural language, frequency of nth most common word is proportional to 1/n
-	totalWords := len(p.enWordFreqs)
-	targetPercentage := percentage / 100.0
+// tagger returns the part-of-speech tagger of a language, or nil when there
+// is none
+func (p *Processor) tagger(lang string) *pos.Tagger {
+	if p.taggers == nil {
+		return nil
+	}
+	return p.taggers.Get(lang)
+}
 
-	// Calculate cumulative frequencies
-	total := 0.0
-	for i := 0; i < totalWords; i++ {
-		total += 1.0 / float64(i+1)
+// tokenRank returns the rank of the first variant of a word token that is in
+// the frequency list, or 0. With a lemmatizer, an inflected form ranks as its
+// lemma when the lemma is more frequent, so "children" is switched along
+// with "child".
+func tokenRank(list *frequency.List, lemmatizer lemma.Lemmatizer, token tokenizer.Token) int {
+	for _, variant := range token.Variants() {
+		rank := list.Rank(variant)
+		if lemmaRank := lemmaRank(list, lemmatizer, variant); lemmaRank > 0 && (rank == 0 || lemmaRank < rank) {
+			rank = lemmaRank
+		}
+		if rank > 0 {
+			return rank
+		}
 	}
+	return 0
+}
 
-	// Find how many words we need
-	cumulative := 0.0
-	for i := 0; i < totalWords; i++ {
-		cumulative += 1.0 / float64(i+1)
-		if cumulative/total >= targetPercentage {
-			return i + 1
+// lemmaRank returns the rank of the first lemma of word that is in the
+// frequency list, or 0
+func lemmaRank(list *frequency.List, lemmatizer lemma.Lemmatizer, word string) int {
+	for _, candidate := range lemmas(list, lemmatizer, word) {
+		if rank := list.Rank(candidate); rank > 0 {
+			return rank
 		}
 	}
+	return 0
+}
 
-	return totalWords
+// lemmas returns the lemmas word may be matched on. Suffix rules turn words
+// such as "only", "used" or "bus" into unrelated ones ("on", "us", "bu"), so
+// their guesses only count for words the frequency list does not have;
+// listed words are only matched on their known irregular lemmas.
+func lemmas(list *frequency.List, lemmatizer lemma.Lemmatizer, word string) []string {
+	switch {
+	case lemmatizer == nil:
+		return nil
+	case list.Rank(word) > 0:
+		return lemmatizer.Known(word)
+	}
+	return lemmatizer.Lemmas(word)
 }
 
-// findWordsToTranslate identifies which high-frequency words appear in the text
-func (p *Processor) findWordsToTranslate(text string, numWords int) []string {
-	words := strings.Fields(strings.ToLower(text))
-	freqWordSet := make(map[string]bool)
+// contextWords is how many words around a word are quoted as its context
+const contextWords = 4
 
-	// Take top N frequency words
-	for i := 0; i < numWords && i < len(p.enWordFreqs); i++ {
-		freqWordSet[p.enWordFreqs[i].word] = true
+// wordContext returns the text around the first unprotected occurrence of
+// word as a whole word, or false when it does not occur
+func wordContext(list *frequency.List, protected []entity.Span, content string, word string) (string, bool) {
+	words := tokenizer.Segment(content, list)
+	for i, token := range words {
+		if token.Normalized() != word || entity.Contains(protected, token) {
+			continue
+		}
+		first := words[max(0, i-contextWords)]
+		last := words[min(len(words)-1, i+contextWords)]
+		return content[first.Start:last.End], true
 	}
+	return "", false
+}
 
-	// Find matches in text
-	matches := make(map[string]bool)
+// translations pairs each switched word with the text that replaced it, for
+// segments that replaced exactly one of the selected words
+func translations(segments []Segment, words []string) map[string]string {
+	selected := make(map[string]bool)
 	for _, word := range words {
-		if freqWordSet[word] {
-			matches[word] = true
-		}
+		selected[word] = true
 	}
-
-	// Convert to slice
-	result := make([]string, 0, len(matches))
-	for word := range matches {
-		result = append(result, word)
+	result := make(map[string]string)
+	for _, seg := range segments {
+		original := tokenizer.Normalize(strings.TrimSpace(seg.Original))
+		if seg.Switched && selected[original] {
+			result[original] = strings.TrimSpace(seg.Text)
+		}
 	}
-
 	return result
 }
 
-func (p *Processor) createCodeSwitchPrompt(content string, originalWords []string, sourceLang, targetLang string) string {
-	// Create a bullet list of words with their contexts
-	var wordContexts []string
-	for _, word := range originalWords {
-		// Find a few words before and after for context
-		index := strings.Index(strings.ToLower(content), strings.ToLower(word))
-		if index >= 0 {
-			start := max(0, index-20)
-			end := min(len(content), index+len(word)+20)
-			context := content[start:end]
-			wordContexts = append(wordContexts, fmt.Sprintf("• %q appears in: %q", word, context))
-		}
+// ProcessParagraph code-switches a paragraph and returns only the new text
+func (p *Processor) ProcessParagraph(content, sourceLang, targetLang string, percentage float64) (string, error) {
+	result, err := p.Process(context.Background(), Request{
+		Text:       content,
+		SourceLang: sourceLang,
+		TargetLang: targetLang,
+		Percentage: percentage,
+	})
+	if err != nil {
+		return "", err
 	}
+	return result.Text, nil
+}
 
-	prompt := fmt.Sprintf(`You are a skilled linguistic expert in code-switching between %s and %s. 
-Please create a naturally code-switched version of this text by translating ONLY the specified words from %s to %s.
-
-Original paragraph:
-%s
-
-Words to translate (with their contexts):
-%s
+// Process code-switches a paragraph and works out which spans were switched
+func (p *Processor) Process(ctx context.Context, req Request) (*Result, error) {
+	j, err := p.prepare(req)
+	if err != nil {
+		return nil, err
+	}
 
-Instructions:
-1. ONLY translate the listed words to %s
-2. Keep all other words in their original %s form
-3. Ensure grammatical agreement between the languages
-4. Maintain all original formatting, punctuation, and capitalization
-5. The translation should feel natural and maintain readability
-6. Adapt articles and word forms to fit the grammar of both languages
+	promptText, opts, err := p.render(j)
+	if err != nil {
+		return nil, err
+	}
+	completion, latency, err := p.complete(ctx, promptText, opts)
+	if err != nil {
+		return nil, err
+	}
+	return p.finish(j, completion.Text, completion.Model, completion.Usage, latency)
+}
 
-Example code-switching:
-English: "The cat was sleeping on the table"
-Words to switch: [was, on, the]
-Result: "The cat var sleeping på table"
+// render creates the prompt of a prepared paragraph and the options to
+// send it with
+func (p *Processor) render(j *job) (string, claude.Options, error) {
+	promptText, err := j.prompts.Render(j.template, j.data)
+	if err != nil {
+		return "", claude.Options{}, fmt.Errorf("error rendering %s prompt: %v", j.template, err)
+	}
+	system, err := j.prompts.System(j.data)
+	if err != nil {
+		return "", claude.Options{}, fmt.Errorf("error rendering system prompt: %v", err)
+	}
+	instructions, err := j.prompts.Instructions(j.template, j.data)
+	if err != nil {
+		return "", claude.Options{}, fmt.Errorf("error rendering %s instructions: %v", j.template, err)
+	}
+	log.Printf("Created %s prompt (version %s) for %d spans", j.template, j.prompts.Version(), len(j.words))
 
-Please provide ONLY the code-switched paragraph as output, without explanations.`,
-		sourceLang, targetLang,
-		sourceLang, targetLang,
-		content,
-		strings.Join(wordContexts, "\n"),
-		targetLang,
-		sourceLang)
+	// The system prompt and instructions are the same for every paragraph of
+	// a language pair, so they go first as a cacheable prefix
+	opts := claude.Options{
+		Model:  j.req.Model,
+		System: claude.Prefix(system, instructions),
+	}
+	p.checkPrefix(j.prompts, j.template, opts)
+	return promptText, opts, nil
+}
 
-	log.Printf("Created prompt for %d words. First few words to translate: %v",
-		len(originalWords),
-		originalWords[:min(5, len(originalWords))])
+// checkPrefix logs once per prompt when the system blocks of opts are too
+// short for the model to cache. Only longer system prompts or instructions,
+// such as ones with few-shot examples, then make calls read the prefix from
+// the cache.
+func (p *Processor) checkPrefix(prompts *prompt.Set, template string, opts claude.Options) {
+	model := opts.Model
+	if model == "" {
+		model = claude.DefaultModel
+	}
+	cacheable, tokens := claude.Cacheable(model, opts.System)
+	key := prompts.Version() + "/" + template + "/" + model
+	if _, logged := p.uncached.LoadOrStore(key, true); !cacheable && !logged {
+		log.Printf("System prefix of the %s prompt (version %s) has about %d tokens, below the %d that %s caches; it is sent uncached",
+			template, prompts.Version(), tokens, claude.MinCacheTokens(model), model)
+	}
+}
 
-	return prompt
+// job is a paragraph prepared for the model: the spans selected for
+// switching and the data of its prompt
+type job struct {
+	req        Request
+	list       *frequency.List
+	lemmatizer lemma.Lemmatizer
+	prompts    *prompt.Set
+	template   string
+	data       prompt.Data
+	words      []string
+	planned    float64
 }
 
-func (p *Processor) ProcessParagraph(content, sourceLang, targetLang string, percentage float64) (string, error) {
-	// Ensure frequency data is loaded
-	if err := p.loadFrequencyData(); err != nil {
-		return "", fmt.Errorf("failed to load frequency data: %v", err)
+// prepare selects the spans of a paragraph to switch and collects its
+// prompt data
+func (p *Processor) prepare(req Request) (*job, error) {
+	// Frequency data for the source language decides which words to switch
+	list, err := p.frequencies.Get(req.SourceLang)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load frequency data: %v", err)
+	}
+	prompts := req.Prompts
+	if prompts == nil {
+		prompts = p.prompts
 	}
 
+	content := req.Text
 	log.Printf("Processing paragraph (%.0f%% target): %s...",
-		percentage,
+		req.Percentage,
 		content[:min(50, len(content))])
 
-	// Calculate number of words needed based on Zipf's law
-	wordsNeeded := p.calculateWordsNeeded(percentage)
-	log.Printf("Calculated need for %d top-frequency words to achieve %.0f%%",
-		wordsNeeded,
-		percentage)
+	lemmatizer := p.lemmatizer(req.SourceLang)
+	protected := entity.Find(content, entity.Options{
+		Lang:    req.SourceLang,
+		Anchors: req.Anchors,
+		Protect: req.Protect,
+		Allow:   req.Allow,
+	})
+	if len(protected) > 0 {
+		log.Printf("Protecting %d names and terms: %v", len(protected), entity.Terms(protected))
+	}
+	var tagger *pos.Tagger
+	if len(req.PartsOfSpeech) > 0 || req.Granularity == GranularityClause {
+		tagger = p.tagger(req.SourceLang)
+	}
+	candidates := newSelection(list, lemmatizer, protected, newWordFilter(req, tagger), content)
+	surrounding := req.Context.fit(content, req.ContextTokens)
+
+	var wordsToTranslate []string
+	var planned float64
+	data := p.promptData(list, protected, req.Translations, surrounding, content, req.SourceLang, req.TargetLang)
+	data.Nonce = prompt.NewNonce()
+	var template string
+	switch req.Granularity {
+	case GranularityPhrase, GranularityClause, GranularitySentence:
+		wordsToTranslate, planned = selectUnits(list, candidates, tagger, req.Granularity, req.Policy, content, req.Percentage)
+		template = string(req.Granularity)
+		data.Units = wordsToTranslate
+
+	default:
+		// Calculate number of words needed from the corpus counts
+		wordsNeeded := p.calculateWordsNeeded(list, req.Percentage)
+		log.Printf("Calculated need for %d top-frequency words to achieve %.0f%%",
+			wordsNeeded,
+			req.Percentage)
+
+		// Adjust the cutoff to what this paragraph actually contains
+		tolerance := req.Tolerance
+		if tolerance <= 0 {
+			tolerance = DefaultTolerance
+		}
+		wordsNeeded, planned = selectCutoff(candidates.ranks, wordsNeeded, req.Percentage, tolerance)
+		log.Printf("Using top %d words, planned to switch %.1f%% of this paragraph", wordsNeeded, planned)
+
+		// Find actual words to translate
+		wordsToTranslate = candidates.words(wordsNeeded)
+		log.Printf("Found %d matching high-frequency words in text: %v",
+			len(wordsToTranslate),
+			wordsToTranslate)
+
+		template = string(GranularityWord)
+		data.Words = wordContexts(list, protected, content, wordsToTranslate)
+		data.Examples = prompts.Examples(req.SourceLang, req.TargetLang)
+	}
 
-	// Find actual words to translate
-	wordsToTranslate := p.findWordsToTranslate(content, wordsNeeded)
-	log.Printf("Found %d matching high-frequency words in text: %v",
-		len(wordsToTranslate),
-		wordsToTranslate)
+	return &job{
+		req:        req,
+		list:       list,
+		lemmatizer: lemmatizer,
+		prompts:    prompts,
+		template:   template,
+		data:       data,
+		words:      wordsToTranslate,
+		planned:    planned,
+	}, nil
+}
 
+// complete sends a prompt once the rate limiter allows and returns the
+// completion with the time the model took
+func (p *Processor) complete(ctx context.Context, promptText string, opts claude.Options) (*claude.Completion, time.Duration, error) {
 	// Wait for rate limiter
 	<-p.rateLimiter
 
-	// Create prompt
-	prompt := p.createCodeSwitchPrompt(content, wordsToTranslate, sourceLang, targetLang)
-
 	log.Printf("Sending request to Claude for code-switching")
-	result, err := p.claudeClient.Complete(context.Background(), prompt)
+	start := time.Now()
+	completion, err := p.claudeClient.CompleteWith(ctx, promptText, opts)
 	if err != nil {
-		return "", fmt.Errorf("error from Claude: %v", err)
+		return nil, 0, fmt.Errorf("error from Claude: %v", err)
+	}
+	usage := completion.Usage
+	log.Printf("Claude used %d input tokens (%d read from and %d written to the prompt cache) and %d output tokens",
+		usage.InputTokens, usage.CacheReadInputTokens, usage.CacheCreationInputTokens, usage.OutputTokens)
+	return completion, time.Since(start), nil
+}
+
+// finish checks the model's text for a prepared paragraph and works out
+// which spans were switched
+func (p *Processor) finish(j *job, text, model string, usage claude.Usage, latency time.Duration) (*Result, error) {
+	req, content := j.req, j.req.Text
+
+	// Instructions hidden in the article can make the model return
+	// something other than the paragraph
+	if err := guard.Check(content, text, guard.Options{Percentage: req.Percentage, Nonce: j.data.Nonce}); err != nil {
+		return nil, err
 	}
 
 	// Log a preview of the result
 	log.Printf("Successfully processed paragraph: %s...",
-		result[:min(50, len(result))])
+		text[:min(50, len(text))])
+
+	result := &Result{
+		Text:          text,
+		Words:         j.words,
+		Segments:      segments(j.list, j.lemmatizer, content, text, req.SourceLang, req.TargetLang),
+		Planned:       j.planned,
+		PromptVersion: j.prompts.Version(),
+		Model:         model,
+		Usage:         usage,
+		Latency:       latency,
+	}
+	result.Translations = translations(result.Segments, j.words)
+	result.SwitchedWords, result.TotalWords = measureSwitched(content, text)
+	if result.TotalWords > 0 {
+		result.Achieved = 100 * float64(result.SwitchedWords) / float64(result.TotalWords)
+	}
+	log.Printf("Achieved %.1f%% switched words (target %.1f%%, planned %.1f%%)",
+		result.Achieved, req.Percentage, j.planned)
 
 	return result, nil
 }
 
+// segments aligns the switched text with the original and labels every span
+// that differs as target language text
+func segments(list *frequency.List, lemmatizer lemma.Lemmatizer, original, switched, sourceLang, targetLang string) []Segment {
+	var segments []Segment
+	for _, op := range align.Diff(original, switched) {
+		if op.Kind == align.Equal {
+			segments = append(segments, Segment{Text: op.Text, Lang: sourceLang})
+			continue
+		}
+		if op.Text == "" {
+			// Words dropped by the model have no span in the output
+			continue
+		}
+		segments = append(segments, switchedSegments(list, lemmatizer, op, sourceLang, targetLang)...)
+	}
+	return segments
+}
+
+// switchedSegments labels the text of an edit as switched. Placeholders of
+// masked markup inside it are split off as source text, so that no switched
+// span crosses a link or emphasis restored around it.
+func switchedSegments(list *frequency.List, lemmatizer lemma.Lemmatizer, op align.Op, sourceLang, targetLang string) []Segment {
+	var originals []string
+	for _, part := range document.SplitPlaceholders(op.Original) {
+		if !document.IsPlaceholder(part) && strings.TrimSpace(part) != "" {
+			originals = append(originals, part)
+		}
+	}
+	var texts []string
+	for _, part := range document.SplitPlaceholders(op.Text) {
+		if !document.IsPlaceholder(part) && strings.TrimSpace(part) != "" {
+			texts = append(texts, part)
+		}
+	}
+	if len(originals) != len(texts) {
+		// Without a piece for piece match the first span takes all of the
+		// original text
+		originals = make([]string, len(texts))
+		if len(texts) > 0 {
+			originals[0] = document.StripPlaceholders(op.Original)
+		}
+	}
+
+	var segments []Segment
+	k := 0
+	for _, part := range document.SplitPlaceholders(op.Text) {
+		if document.IsPlaceholder(part) || strings.TrimSpace(part) == "" {
+			segments = append(segments, Segment{Text: part, Lang: sourceLang})
+			continue
+		}
+		segments = append(segments, Segment{
+			Text:     part,
+			Lang:     targetLang,
+			Original: originals[k],
+			Rank:     bestRank(list, lemmatizer, originals[k]),
+			Switched: true,
+		})
+		k++
+	}
+	return segments
+}
+
+// bestRank returns the best (lowest) frequency rank among the words of text,
+// or 0 when none of them are in the frequency list
+func bestRank(list *frequency.List, lemmatizer lemma.Lemmatizer, text string) int {
+	best := 0
+	for _, token := range tokenizer.Segment(text, list) {
+		if rank := tokenRank(list, lemmatizer, token); rank > 0 && (best == 0 || rank < best) {
+			best = rank
+		}
+	}
+	return best
+}
+
 // Helper function for min
 func min(a, b int) int {
 	if a < b {
@@ -0,0 +1,119 @@
+package processor
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/mrconter1/codeswitch-ai/internal/align"
+	"github.com/mrconter1/codeswitch-ai/internal/frequency"
+	"github.com/mrconter1/codeswitch-ai/pkg/lemma"
+	"github.com/mrconter1/codeswitch-ai/pkg/tokenizer"
+)
+
+// testList builds a frequency list ranking words in the order given
+func testList(t testing.TB, words ...string) *frequency.List {
+	t.Helper()
+	var b strings.Builder
+	for i, word := range words {
+		b.WriteString(word)
+		b.WriteString(" ")
+		b.WriteString(strings.Repeat("9", len(words)-i))
+		b.WriteString("\n")
+	}
+	list, err := frequency.Parse("en", strings.NewReader(b.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return list
+}
+
+func TestTokenRankLemmas(t *testing.T) {
+	list := testList(t, "on", "us", "even", "go", "child", "cat", "bu",
+		"only", "used", "evening", "bus", "went", "children")
+	lemmatizer := lemma.NewRegistry("").Get("en")
+	if lemmatizer == nil {
+		t.Fatal("no English lemmatizer")
+	}
+
+	tests := []struct {
+		word string
+		want string
+	}{
+		// Suffix rules do not override the rank of a listed word
+		{"only", "only"},
+		{"used", "used"},
+		{"evening", "evening"},
+		{"bus", "bus"},
+		// Irregular forms rank as their lemma
+		{"went", "go"},
+		{"children", "child"},
+		// Unlisted words fall back to the rules
+		{"cats", "cat"},
+	}
+	for _, tt := range tests {
+		token := tokenizer.Words(tt.word)[0]
+		if got, want := tokenRank(list, lemmatizer, token), list.Rank(tt.want); got != want {
+			t.Errorf("tokenRank(%q) = %d, want %d (rank of %q)", tt.word, got, want, tt.want)
+		}
+	}
+
+	if tokenRank(list, lemmatizer, tokenizer.Words("onlys")[0]) != list.Rank("only") {
+		t.Errorf("unlisted word does not rank as its listed rule lemma")
+	}
+	if got := tokenRank(list, nil, tokenizer.Words("cats")[0]); got != 0 {
+		t.Errorf("tokenRank without lemmatizer = %d, want 0", got)
+	}
+}
+
+func TestMatchesLemmas(t *testing.T) {
+	list := testList(t, "on", "go", "only", "went")
+	lemmatizer := lemma.NewRegistry("").Get("en")
+	set := map[string]bool{"on": true, "go": true}
+
+	if matches(set, list, lemmatizer, "only") {
+		t.Errorf(`"only" matches "on" through a suffix rule`)
+	}
+	if !matches(set, list, lemmatizer, "went") {
+		t.Errorf(`"went" does not match its irregular lemma "go"`)
+	}
+	if !matches(set, list, lemmatizer, "goes") {
+		t.Errorf(`unlisted "goes" does not match "go" through a suffix rule`)
+	}
+}
+
+func TestSegmentsDoNotCrossPlaceholders(t *testing.T) {
+	list := testList(t, "the", "cat", "sat", "on", "mat")
+
+	// A substitution spanning a link, as when the model moves its
+	// placeholders, becomes switched spans around them
+	op := align.Op{Kind: align.Substitute, Original: "the ⟦0⟧cat⟦1⟧", Text: "⟦0⟧katten⟦1⟧"}
+	got := switchedSegments(list, nil, op, "en", "sv")
+	want := []Segment{
+		{Text: "⟦0⟧", Lang: "en"},
+		{Text: "katten", Lang: "sv", Original: "the cat", Rank: list.Rank("the"), Switched: true},
+		{Text: "⟦1⟧", Lang: "en"},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("switchedSegments = %+v, want %+v", got, want)
+	}
+
+	// Pieces between placeholders pair up when both sides have as many
+	op = align.Op{Kind: align.Substitute, Original: "cat⟦1⟧ sat", Text: "katt⟦1⟧ satt"}
+	got = switchedSegments(list, nil, op, "en", "sv")
+	if len(got) != 3 || got[0].Original != "cat" || got[2].Original != " sat" || got[1].Switched {
+		t.Errorf("switchedSegments = %+v, want katt and satt switched apart", got)
+	}
+
+	var rebuilt strings.Builder
+	original, switched := "The ⟦0⟧cat⟦1⟧ sat on the ⟦2⟧mat⟦3⟧.", "⟦0⟧Katten⟦1⟧ satt på ⟦2⟧mattan⟦3⟧."
+	for _, s := range segments(list, nil, original, switched, "en", "sv") {
+		rebuilt.WriteString(s.Text)
+		if s.Switched && strings.ContainsAny(s.Text+s.Original, "⟦⟧") {
+			t.Errorf("switched segment %+v contains a placeholder", s)
+		}
+	}
+	if rebuilt.String() != switched {
+		t.Errorf("segments rebuild %q, want %q", rebuilt.String(), switched)
+	}
+}
@@ -0,0 +1,49 @@
+package processor
+
+import (
+	"github.com/mrconter1/codeswitch-ai/internal/entity"
+	"github.com/mrconter1/codeswitch-ai/internal/frequency"
+	"github.com/mrconter1/codeswitch-ai/internal/prompt"
+	"github.com/mrconter1/codeswitch-ai/pkg/tokenizer"
+)
+
+// promptData collects what every prompt template gets: the paragraph, its
+// read-only context, the names to keep and the fixed translations of words
+// occurring in the paragraph
+func (p *Processor) promptData(list *frequency.List, protected []entity.Span, translations map[string]string, surrounding Context, content, sourceLang, targetLang string) prompt.Data {
+	data := prompt.Data{
+		SourceLang: sourceLang,
+		TargetLang: targetLang,
+		Paragraph:  content,
+		Keep:       entity.Terms(protected),
+		Context: prompt.Context{
+			Heading: surrounding.Heading,
+			Before:  surrounding.Before,
+			After:   surrounding.After,
+		},
+	}
+
+	if len(translations) > 0 {
+		seen := make(map[string]bool)
+		for _, token := range tokenizer.Segment(content, list) {
+			word := token.Normalized()
+			if translation, ok := translations[word]; ok && !seen[word] {
+				seen[word] = true
+				data.Translations = append(data.Translations, prompt.Translation{Word: word, Translation: translation})
+			}
+		}
+	}
+	return data
+}
+
+// wordContexts pairs each word to translate with the text around its first
+// unprotected occurrence
+func wordContexts(list *frequency.List, protected []entity.Span, content string, words []string) []prompt.WordContext {
+	var contexts []prompt.WordContext
+	for _, word := range words {
+		if context, ok := wordContext(list, protected, content, word); ok {
+			contexts = append(contexts, prompt.WordContext{Word: word, Context: context})
+		}
+	}
+	return contexts
+}
@@ -0,0 +1,128 @@
+package processor
+
+import (
+	"log"
+
+	"github.com/mrconter1/codeswitch-ai/internal/entity"
+	"github.com/mrconter1/codeswitch-ai/internal/frequency"
+	"github.com/mrconter1/codeswitch-ai/pkg/lemma"
+	"github.com/mrconter1/codeswitch-ai/pkg/pos"
+	"github.com/mrconter1/codeswitch-ai/pkg/tokenizer"
+)
+
+// alwaysSwitched is the rank given to words the request asks to always
+// switch; they are selected whatever the cutoff
+const alwaysSwitched = -1
+
+// selected reports whether a token of the given rank is switched when the
+// top n words are
+func selected(rank, n int) bool {
+	return rank == alwaysSwitched || (rank > 0 && rank <= n)
+}
+
+// wordFilter holds the per-request controls over which words may be switched
+type wordFilter struct {
+	include map[string]bool
+	exclude map[string]bool
+	parts   map[pos.Tag]bool
+	tagger  *pos.Tagger
+}
+
+func newWordFilter(req Request, tagger *pos.Tagger) wordFilter {
+	f := wordFilter{
+		include: wordSet(req.Include),
+		exclude: wordSet(req.Exclude),
+		tagger:  tagger,
+	}
+	if len(req.PartsOfSpeech) > 0 {
+		if tagger == nil {
+			log.Printf("No part-of-speech data for %s, switching all parts of speech", req.SourceLang)
+		} else {
+			f.parts = make(map[pos.Tag]bool)
+			for _, tag := range req.PartsOfSpeech {
+				f.parts[tag] = true
+			}
+		}
+	}
+	return f
+}
+
+func wordSet(words []string) map[string]bool {
+	set := make(map[string]bool)
+	for _, word := range words {
+		set[tokenizer.Normalize(word)] = true
+	}
+	return set
+}
+
+// matches reports whether a word or one of its lemmas is in set, so that
+// listing "go" also covers "went"
+func matches(set map[string]bool, list *frequency.List, lemmatizer lemma.Lemmatizer, word string) bool {
+	if len(set) == 0 {
+		return false
+	}
+	if set[word] {
+		return true
+	}
+	for _, l := range lemmas(list, lemmatizer, word) {
+		if set[l] {
+			return true
+		}
+	}
+	return false
+}
+
+// selection is the word tokens of a paragraph with the rank at which each may
+// be switched, 0 for tokens that are never switched
+type selection struct {
+	tokens []tokenizer.Token
+	ranks  []int
+}
+
+// newSelection ranks the words of text. Protected names and excluded words
+// are never switched; included words are always switched; words of other
+// parts of speech than requested are left out. Everything else is ranked by
+// frequency.
+func newSelection(list *frequency.List, lemmatizer lemma.Lemmatizer, protected []entity.Span, filter wordFilter, text string) selection {
+	tokens := tokenizer.Segment(text, list)
+
+	var tags []pos.Tag
+	if filter.parts != nil {
+		words := make([]string, len(tokens))
+		for i, token := range tokens {
+			words[i] = token.Normalized()
+		}
+		tags = filter.tagger.Tag(words, lemmatizer)
+	}
+
+	ranks := make([]int, len(tokens))
+	for i, token := range tokens {
+		word := token.Normalized()
+		switch {
+		case entity.Contains(protected, token):
+		case matches(filter.exclude, list, lemmatizer, word):
+		case matches(filter.include, list, lemmatizer, word):
+			ranks[i] = alwaysSwitched
+		case tags != nil && !filter.parts[tags[i]]:
+		default:
+			ranks[i] = tokenRank(list, lemmatizer, token)
+		}
+	}
+	return selection{tokens: tokens, ranks: ranks}
+}
+
+// words returns the distinct normalized words selected when the top
+// numWords are switched, in order of appearance
+func (s selection) words(numWords int) []string {
+	seen := make(map[string]bool)
+	var result []string
+	for i, token := range s.tokens {
+		word := token.Normalized()
+		if seen[word] || !selected(s.ranks[i], numWords) {
+			continue
+		}
+		seen[word] = true
+		result = append(result, word)
+	}
+	return result
+}
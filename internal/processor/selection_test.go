@@ -0,0 +1,125 @@
+package processor
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/mrconter1/codeswitch-ai/internal/frequency"
+	"github.com/mrconter1/codeswitch-ai/pkg/lemma"
+)
+
+// benchText is a paragraph of ordinary English prose
+const benchText = `The history of the city goes back to the time when the first settlers came to the valley
+and built their houses along the river. Over the years it grew into one of the most important trading
+places in the region, and many of the buildings that were made in that period can still be seen today.
+People who visit the old town often say that it is the best place to understand how life was lived here.`
+
+// benchList ranks the words of benchText first, followed by enough filler
+// words to be the size of a FrequencyWords list
+func benchList(b *testing.B) *frequency.List {
+	var words strings.Builder
+	rank := 1
+	seen := make(map[string]bool)
+	for _, word := range strings.Fields(strings.ToLower(benchText)) {
+		word = strings.Trim(word, ".,")
+		if !seen[word] {
+			seen[word] = true
+			fmt.Fprintf(&words, "%s %d\n", word, 10000000/rank)
+			rank++
+		}
+	}
+	for ; rank <= 50000; rank++ {
+		fmt.Fprintf(&words, "word%d %d\n", rank, 10000000/rank)
+	}
+	list, err := frequency.Parse("en", strings.NewReader(words.String()))
+	if err != nil {
+		b.Fatal(err)
+	}
+	return list
+}
+
+// quiet silences the per-paragraph logging for the rest of a benchmark
+func quiet(b *testing.B) {
+	out := log.Writer()
+	log.SetOutput(io.Discard)
+	b.Cleanup(func() { log.SetOutput(out) })
+}
+
+func BenchmarkNewSelection(b *testing.B) {
+	list := benchList(b)
+	lemmatizer := lemma.NewRegistry("").Get("en")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		newSelection(list, lemmatizer, nil, wordFilter{}, benchText)
+	}
+}
+
+func BenchmarkSelectCutoff(b *testing.B) {
+	quiet(b)
+	list := benchList(b)
+	candidates := newSelection(list, nil, nil, wordFilter{}, benchText)
+	estimate := list.Coverage().RankFor(0.5)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		selectCutoff(candidates.ranks, estimate, 50, DefaultTolerance)
+	}
+}
+
+// BenchmarkSelectWords runs the whole word selection of a paragraph, as
+// prepare does for the word granularity
+func BenchmarkSelectWords(b *testing.B) {
+	quiet(b)
+	list := benchList(b)
+	lemmatizer := lemma.NewRegistry("").Get("en")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		candidates := newSelection(list, lemmatizer, nil, wordFilter{}, benchText)
+		cutoff, _ := selectCutoff(candidates.ranks, list.Coverage().RankFor(0.5), 50, DefaultTolerance)
+		candidates.words(cutoff)
+	}
+}
+
+// legacySelectWords is the word selection before the rank index, kept as a
+// baseline for BenchmarkSelectWords: it reruns the harmonic sums for the
+// words needed and builds a set of that many top words for every paragraph
+func legacySelectWords(list *frequency.List, text string, percentage float64) []string {
+	total := 0.0
+	for i := range list.Words {
+		total += 1.0 / float64(i+1)
+	}
+	numWords, cumulative := len(list.Words), 0.0
+	for i := range list.Words {
+		cumulative += 1.0 / float64(i+1)
+		if cumulative/total >= percentage/100 {
+			numWords = i + 1
+			break
+		}
+	}
+
+	top := make(map[string]bool)
+	for _, wf := range list.Words[:numWords] {
+		top[wf.Word] = true
+	}
+	matches := make(map[string]bool)
+	for _, word := range strings.Fields(strings.ToLower(text)) {
+		if top[word] {
+			matches[word] = true
+		}
+	}
+	result := make([]string, 0, len(matches))
+	for word := range matches {
+		result = append(result, word)
+	}
+	return result
+}
+
+func BenchmarkLegacySelectWords(b *testing.B) {
+	list := benchList(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		legacySelectWords(list, benchText, 50)
+	}
+}
@@ -0,0 +1,98 @@
+package processor
+
+import (
+	"log"
+	"math"
+	"sort"
+
+	"github.com/mrconter1/codeswitch-ai/internal/align"
+)
+
+// DefaultTolerance is how far, in percentage points, the planned share of
+// switched tokens may be from the requested percentage
+const DefaultTolerance = 5.0
+
+// selectCutoff picks how many top frequency words to switch in this
+// paragraph, starting from the corpus estimate. The estimate is kept when
+// its share of the paragraph's tokens is within tolerance of the target;
+// otherwise the cutoff moves to the nearest one that is. When no cutoff is
+// within tolerance, the one whose share is closest to the target wins (the
+// lower share on ties). Estimate, and the range of cutoffs within
+// tolerance, only grow with the target, so a higher percentage always
+// switches a superset of the words of a lower one.
+func selectCutoff(ranks []int, estimate int, target, tolerance float64) (int, float64) {
+	if len(ranks) == 0 {
+		return estimate, 0
+	}
+
+	// The share only changes at ranks that occur in the paragraph, so those
+	// and 0 are the distinct cutoffs, with the share each of them plans
+	always := 0
+	var sorted []int
+	for _, rank := range ranks {
+		switch {
+		case rank == alwaysSwitched:
+			always++
+		case rank > 0:
+			sorted = append(sorted, rank)
+		}
+	}
+	sort.Ints(sorted)
+	percent := func(count int) float64 {
+		return 100 * float64(count) / float64(len(ranks))
+	}
+	cutoffs, shares := []int{0}, []float64{percent(always)}
+	for i, rank := range sorted {
+		if i+1 < len(sorted) && sorted[i+1] == rank {
+			continue
+		}
+		cutoffs = append(cutoffs, rank)
+		shares = append(shares, percent(always+i+1))
+	}
+
+	// lo is the first cutoff reaching the tolerance band, hi the last one
+	// not beyond it
+	low, high := target-tolerance, target+tolerance
+	lo := sort.Search(len(shares), func(k int) bool { return shares[k] >= low })
+	hi := sort.Search(len(shares), func(k int) bool { return shares[k] > high }) - 1
+	// The estimate selects what the highest cutoff not above it selects
+	at := sort.SearchInts(cutoffs, estimate+1) - 1
+	estimateShare := shares[max(at, 0)]
+
+	var best int
+	var bestShare float64
+	switch {
+	case lo <= hi && estimateShare < low:
+		best, bestShare = cutoffs[lo], shares[lo]
+	case lo <= hi && estimateShare > high:
+		best, bestShare = cutoffs[hi], shares[hi]
+	case lo <= hi:
+		best, bestShare = cutoffs[max(at, 0)], estimateShare
+	case lo == len(shares) || (lo > 0 && target-shares[lo-1] <= shares[lo]-target):
+		// The shares jump over the band; take the closer neighbour of it
+		best, bestShare = cutoffs[lo-1], shares[lo-1]
+	default:
+		best, bestShare = cutoffs[lo], shares[lo]
+	}
+
+	log.Printf("Corpus estimate of top %d words switches %.1f%% of this paragraph; cutoff %d switches %.1f%% (target %.1f%%)",
+		estimate, estimateShare, best, bestShare, target)
+	if math.Abs(bestShare-target) > tolerance {
+		log.Printf("Paragraph cannot get within %.1f points of %.1f%%, closest is %.1f%%", tolerance, target, bestShare)
+	}
+	return best, bestShare
+}
+
+// measureSwitched counts the source words that were replaced or dropped in
+// the switched text, and the total number of source words
+func measureSwitched(original, switched string) (int, int) {
+	changed, total := 0, 0
+	for _, op := range align.Diff(original, switched) {
+		words := len(align.Words(op.Original))
+		total += words
+		if op.Kind != align.Equal {
+			changed += words
+		}
+	}
+	return changed, total
+}
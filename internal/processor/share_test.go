@@ -0,0 +1,77 @@
+package processor
+
+import "testing"
+
+func TestSelectCutoffKeepsEstimateWithinTolerance(t *testing.T) {
+	// Ten tokens: ranks 1..8, one never switched and one always switched
+	ranks := []int{1, 2, 3, 4, 5, 6, 7, 8, 0, alwaysSwitched}
+
+	cutoff, share := selectCutoff(ranks, 4, 50, 5)
+	if cutoff != 4 || share != 50 {
+		t.Errorf("estimate within tolerance: got cutoff %d (%.0f%%), want 4 (50%%)", cutoff, share)
+	}
+
+	// Tolerance decides whether a nearby estimate is good enough
+	if cutoff, _ := selectCutoff(ranks, 5, 50, 10); cutoff != 5 {
+		t.Errorf("estimate 10 points off with tolerance 10: got cutoff %d, want 5", cutoff)
+	}
+	if cutoff, share := selectCutoff(ranks, 5, 50, 5); cutoff != 4 || share != 50 {
+		t.Errorf("estimate 10 points off with tolerance 5: got cutoff %d (%.0f%%), want 4 (50%%)", cutoff, share)
+	}
+}
+
+func TestSelectCutoffMovesToTolerance(t *testing.T) {
+	ranks := []int{10, 20, 30, 40, 50, 60, 70, 80, 90, 100}
+
+	tests := []struct {
+		estimate  int
+		target    float64
+		tolerance float64
+		want      int
+	}{
+		{estimate: 5, target: 40, tolerance: 5, want: 40},     // too low, up to the band
+		{estimate: 1000, target: 40, tolerance: 5, want: 40},  // too high, down to the band
+		{estimate: 1000, target: 40, tolerance: 15, want: 50}, // highest cutoff within the band
+		{estimate: 1000, target: 0, tolerance: 0, want: 0},
+		{estimate: 0, target: 100, tolerance: 0, want: 100},
+	}
+	for _, tt := range tests {
+		if got, _ := selectCutoff(ranks, tt.estimate, tt.target, tt.tolerance); got != tt.want {
+			t.Errorf("selectCutoff(estimate %d, target %.0f, tolerance %.0f) = %d, want %d",
+				tt.estimate, tt.target, tt.tolerance, got, tt.want)
+		}
+	}
+}
+
+func TestSelectCutoffClosestWhenNoneWithinTolerance(t *testing.T) {
+	// Shares jump from 25% to 75% at rank 2
+	ranks := []int{1, 2, 2, 3}
+
+	if cutoff, share := selectCutoff(ranks, 0, 45, 5); cutoff != 1 || share != 25 {
+		t.Errorf("got cutoff %d (%.0f%%), want 1 (25%%)", cutoff, share)
+	}
+	if cutoff, share := selectCutoff(ranks, 0, 55, 5); cutoff != 2 || share != 75 {
+		t.Errorf("got cutoff %d (%.0f%%), want 2 (75%%)", cutoff, share)
+	}
+	// Ties go to the lower share
+	if cutoff, _ := selectCutoff(ranks, 0, 50, 5); cutoff != 1 {
+		t.Errorf("tie: got cutoff %d, want 1", cutoff)
+	}
+}
+
+func TestSelectCutoffNestedAcrossTargets(t *testing.T) {
+	ranks := []int{3, 17, 17, 42, 5, 0, 250, 1200, 9, 3, 64, alwaysSwitched, 17, 800}
+	// Estimates grow with the target, as the corpus coverage does
+	estimate := func(target float64) int { return int(target * target / 4) }
+
+	for _, tolerance := range []float64{0, 2, 5, 10, 30} {
+		last := -1
+		for target := 0.0; target <= 100; target += 0.5 {
+			cutoff, _ := selectCutoff(ranks, estimate(target), target, tolerance)
+			if cutoff < last {
+				t.Fatalf("tolerance %.0f: cutoff %d at %.1f%% is below %d at a lower target", tolerance, cutoff, target, last)
+			}
+			last = cutoff
+		}
+	}
+}
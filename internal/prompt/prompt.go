@@ -0,0 +1,289 @@
+package prompt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// bundled holds the default templates. A template directory contains:
+//
+//	VERSION            the name of the prompt version, e.g. "v3"
+//	*.tmpl             one template per prompt, executed by file name;
+//	                   system.tmpl, if present, is the system prompt and
+//	                   batch.tmpl the prompt for several paragraphs at once.
+//	                   A prompt may define "<name>.instructions", the part
+//	                   that is the same on every call, sent first so the
+//	                   provider can cache it.
+//	examples/*.json    few-shot examples per language pair, e.g. en-sv.json
+//
+//go:embed templates
+var bundled embed.FS
+
+// Example is a few-shot example of word switching for a language pair
+type Example struct {
+	Text   string   `json:"text"`
+	Words  []string `json:"words"`
+	Result string   `json:"result"`
+}
+
+// WordContext is a word to switch with the text around it
+type WordContext struct {
+	Word    string
+	Context string
+}
+
+// Translation is a fixed translation the model must reuse
+type Translation struct {
+	Word        string
+	Translation string
+}
+
+// Context is read-only text around the paragraph
+type Context struct {
+	Heading string
+	Before  []string
+	After   []string
+}
+
+// Data is what the templates are executed with. Prompts for single words use
+// Words; prompts for phrases, clauses and sentences use Units. Nonce is a
+// random value that names the tags around article content, so the content
+// cannot close them and pass itself off as instructions. Batch is set when
+// rendering the system prompt of a batch.
+type Data struct {
+	Nonce        string
+	Batch        bool
+	SourceLang   string
+	TargetLang   string
+	Paragraph    string
+	Words        []WordContext
+	Units        []string
+	Keep         []string
+	Translations []Translation
+	Context      Context
+	Examples     []Example
+}
+
+// Set is a loaded collection of templates and examples. Its version changes
+// whenever any of its files change, so it can key cached outputs.
+type Set struct {
+	templates *template.Template
+	examples  map[string][]Example
+	version   string
+}
+
+// Load reads a template set from fsys
+func Load(fsys fs.FS) (*Set, error) {
+	name, err := fs.ReadFile(fsys, "VERSION")
+	if err != nil {
+		return nil, fmt.Errorf("reading VERSION: %v", err)
+	}
+
+	files, err := fs.Glob(fsys, "*.tmpl")
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no templates found")
+	}
+	exampleFiles, err := fs.Glob(fsys, "examples/*.json")
+	if err != nil {
+		return nil, err
+	}
+
+	// The version combines the declared name with a hash of every file
+	hash := sha256.New()
+	all := append(append([]string{"VERSION"}, files...), exampleFiles...)
+	sort.Strings(all)
+	for _, file := range all {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(hash, "%s\x00%d\x00", file, len(data))
+		hash.Write(data)
+	}
+
+	templates, err := template.New("").Funcs(template.FuncMap{
+		"quote": func(s string) string { return fmt.Sprintf("%q", s) },
+		"join":  strings.Join,
+		"inc":   func(i int) int { return i + 1 },
+	}).ParseFS(fsys, files...)
+	if err != nil {
+		return nil, err
+	}
+
+	examples := make(map[string][]Example)
+	for _, file := range exampleFiles {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		var pair []Example
+		if err := json.Unmarshal(data, &pair); err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		examples[strings.TrimSuffix(path.Base(file), ".json")] = pair
+	}
+
+	return &Set{
+		templates: templates,
+		examples:  examples,
+		version:   fmt.Sprintf("%s-%s", strings.TrimSpace(string(name)), hex.EncodeToString(hash.Sum(nil))[:8]),
+	}, nil
+}
+
+// LoadDir reads a template set from a directory, or the bundled templates
+// when dir is empty
+func LoadDir(dir string) (*Set, error) {
+	if dir == "" {
+		return Default(), nil
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+	return Load(os.DirFS(dir))
+}
+
+var (
+	defaultOnce sync.Once
+	defaultSet  *Set
+)
+
+// Default returns the bundled template set
+func Default() *Set {
+	defaultOnce.Do(func() {
+		fsys, err := fs.Sub(bundled, "templates")
+		if err == nil {
+			defaultSet, err = Load(fsys)
+		}
+		if err != nil {
+			panic(fmt.Sprintf("bundled prompt templates: %v", err))
+		}
+	})
+	return defaultSet
+}
+
+// Version identifies the templates and examples of the set
+func (s *Set) Version() string {
+	return s.version
+}
+
+// Examples returns the few-shot examples for a language pair, falling back
+// to the base language codes ("zh_tw" → "zh"); nil when there are none
+func (s *Set) Examples(sourceLang, targetLang string) []Example {
+	base := func(code string) string {
+		b, _, _ := strings.Cut(code, "_")
+		return b
+	}
+	if examples, ok := s.examples[sourceLang+"-"+targetLang]; ok {
+		return examples
+	}
+	return s.examples[base(sourceLang)+"-"+base(targetLang)]
+}
+
+// NewNonce returns a random value for Data.Nonce
+func NewNonce() string {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		panic(fmt.Sprintf("reading random nonce: %v", err))
+	}
+	return hex.EncodeToString(buf)
+}
+
+// System renders the system prompt, or returns "" when the set has none
+func (s *Set) System(data Data) (string, error) {
+	text, err := s.Render("system", data)
+	if errors.Is(err, ErrUnknownTemplate) {
+		return "", nil
+	}
+	return text, err
+}
+
+// Batch is what batch.tmpl is executed with: several paragraphs of the same
+// granularity answered in one response, each between numbered result tags
+// named with the nonce. Every item shares the batch's nonce.
+type Batch struct {
+	Nonce       string
+	SourceLang  string
+	TargetLang  string
+	Granularity string
+	Items       []Data
+	Examples    []Example
+}
+
+// RenderBatch executes batch.tmpl
+func (s *Set) RenderBatch(b Batch) (string, error) {
+	for i := range b.Items {
+		b.Items[i].Nonce = b.Nonce
+	}
+	return s.execute("batch", "batch.tmpl", b)
+}
+
+// ParseBatch splits the response to a batch prompt of n paragraphs into the
+// text of each. Paragraphs that are missing, empty or answered more than
+// once are returned as "", so they can be retried on their own.
+func ParseBatch(response, nonce string, n int) []string {
+	texts := make([]string, n)
+	seen := make([]int, n)
+	results := regexp.MustCompile(`(?s)<result-` + regexp.QuoteMeta(nonce) + ` id="(\d+)">(.*?)</result-` + regexp.QuoteMeta(nonce) + `>`)
+	for _, m := range results.FindAllStringSubmatch(response, -1) {
+		id, err := strconv.Atoi(m[1])
+		if err != nil || id < 1 || id > n {
+			continue
+		}
+		seen[id-1]++
+		texts[id-1] = strings.TrimSpace(m[2])
+	}
+	for i := range texts {
+		if seen[i] != 1 {
+			texts[i] = ""
+		}
+	}
+	return texts
+}
+
+// ErrUnknownTemplate is returned for a template name that is not in the set
+var ErrUnknownTemplate = errors.New("unknown prompt template")
+
+// Render executes the template called name (name.tmpl) with data
+func (s *Set) Render(name string, data Data) (string, error) {
+	return s.execute(name, name+".tmpl", data)
+}
+
+// Instructions executes the stable instructions of the prompt called name,
+// which depend only on the languages, granularity and examples of data (a
+// Data or Batch). It returns "" when the prompt defines none.
+func (s *Set) Instructions(name string, data interface{}) (string, error) {
+	if s.templates.Lookup(name+".instructions") == nil {
+		return "", nil
+	}
+	return s.execute(name, name+".instructions", data)
+}
+
+func (s *Set) execute(name, file string, data interface{}) (string, error) {
+	t := s.templates.Lookup(file)
+	if t == nil {
+		return "", fmt.Errorf("%w %q", ErrUnknownTemplate, name)
+	}
+	var b bytes.Buffer
+	if err := t.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(b.String()), nil
+}
@@ -0,0 +1,41 @@
+package prompt
+
+import (
+	"testing"
+
+	"github.com/mrconter1/codeswitch-ai/pkg/claude"
+)
+
+// TestBundledPrefixCacheable checks that the system prompt and instructions
+// of every bundled prompt are long enough for the default model to cache
+// them, for each language pair with examples
+func TestBundledPrefixCacheable(t *testing.T) {
+	set := Default()
+	for _, pair := range [][2]string{{"en", "sv"}, {"en", "es"}, {"sv", "en"}} {
+		examples := set.Examples(pair[0], pair[1])
+		if len(examples) == 0 {
+			t.Fatalf("no examples for %s-%s", pair[0], pair[1])
+		}
+
+		for _, name := range []string{"word", "phrase", "clause", "sentence", "task", "batch"} {
+			data := Data{SourceLang: pair[0], TargetLang: pair[1], Batch: name == "batch", Examples: examples}
+			system, err := set.System(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var instructions string
+			if name == "batch" {
+				instructions, err = set.Instructions(name, Batch{SourceLang: pair[0], TargetLang: pair[1], Granularity: "word", Examples: examples})
+			} else {
+				instructions, err = set.Instructions(name, data)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if cacheable, tokens := claude.Cacheable(claude.DefaultModel, claude.Prefix(system, instructions)); !cacheable {
+				t.Errorf("%s prefix for %s-%s has about %d tokens, below %d", name, pair[0], pair[1], tokens, claude.MinCacheTokens(claude.DefaultModel))
+			}
+		}
+	}
+}
@@ -46,6 +46,34 @@ func (c *Cache) Get(ctx context.Context, key string) (string, error) {
 	return c.client.Get(ctx, key).Result()
 }
 
+// GetDelete retrieves a value and removes it from the cache in one step, so
+// of several concurrent callers only one gets it
+func (c *Cache) GetDelete(ctx context.Context, key string) (string, error) {
+	return c.client.GetDel(ctx, key).Result()
+}
+
+// Delete removes a key from the cache
+func (c *Cache) Delete(ctx context.Context, key string) error {
+	return c.client.Del(ctx, key).Err()
+}
+
+// IncrementFields adds each value to the field of the same name in the hash
+// at key, in a single transaction
+func (c *Cache) IncrementFields(ctx context.Context, key string, values map[string]float64) error {
+	pipe := c.client.TxPipeline()
+	for field, value := range values {
+		pipe.HIncrByFloat(ctx, key, field, value)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// GetFields returns all fields of the hash at key, empty when it does not
+// exist
+func (c *Cache) GetFields(ctx context.Context, key string) (map[string]string, error) {
+	return c.client.HGetAll(ctx, key).Result()
+}
+
 func (c *Cache) GetArticle(title string) (string, error) {
 	ctx := context.Background()
 
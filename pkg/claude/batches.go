@@ -0,0 +1,185 @@
+package claude
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"time"
+)
+
+// MaxBatchRequests is the largest number of requests a message batch takes
+const MaxBatchRequests = 100000
+
+// Processing states of a message batch
+const (
+	BatchInProgress = "in_progress"
+	BatchCanceling  = "canceling"
+	BatchEnded      = "ended"
+)
+
+// customID is the form the API accepts for the IDs of batch requests
+var customID = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// BatchRequest is one completion of a message batch. CustomID identifies
+// its result and has to be unique within the batch.
+type BatchRequest struct {
+	CustomID string
+	Prompt   string
+	Options  Options
+}
+
+type batchRequest struct {
+	CustomID string  `json:"custom_id"`
+	Params   request `json:"params"`
+}
+
+// Batch is the state of a message batch. Its results can be read once
+// ProcessingStatus is BatchEnded.
+type Batch struct {
+	ID               string        `json:"id"`
+	ProcessingStatus string        `json:"processing_status"`
+	RequestCounts    RequestCounts `json:"request_counts"`
+	CreatedAt        time.Time     `json:"created_at"`
+	EndedAt          *time.Time    `json:"ended_at"`
+	ExpiresAt        time.Time     `json:"expires_at"`
+	ResultsURL       string        `json:"results_url"`
+}
+
+// RequestCounts counts the requests of a batch by their state
+type RequestCounts struct {
+	Processing int `json:"processing"`
+	Succeeded  int `json:"succeeded"`
+	Errored    int `json:"errored"`
+	Canceled   int `json:"canceled"`
+	Expired    int `json:"expired"`
+}
+
+// BatchResult is the outcome of one request of a batch: a completion, or
+// the error it failed, was canceled or expired with
+type BatchResult struct {
+	CustomID   string
+	Completion *Completion
+	Err        error
+}
+
+type batchResultLine struct {
+	CustomID string `json:"custom_id"`
+	Result   struct {
+		Type    string   `json:"type"`
+		Message response `json:"message"`
+		Error   struct {
+			Error struct {
+				Type    string `json:"type"`
+				Message string `json:"message"`
+			} `json:"error"`
+		} `json:"error"`
+	} `json:"result"`
+}
+
+// CreateBatch submits requests as one message batch, which the API
+// processes asynchronously at a lower price than single completions
+func (c *Client) CreateBatch(ctx context.Context, reqs []BatchRequest) (*Batch, error) {
+	if len(reqs) == 0 || len(reqs) > MaxBatchRequests {
+		return nil, fmt.Errorf("a batch takes between 1 and %d requests, got %d", MaxBatchRequests, len(reqs))
+	}
+	body := struct {
+		Requests []batchRequest `json:"requests"`
+	}{}
+	seen := make(map[string]bool)
+	for _, req := range reqs {
+		if !customID.MatchString(req.CustomID) || seen[req.CustomID] {
+			return nil, fmt.Errorf("invalid or duplicate custom ID %q", req.CustomID)
+		}
+		seen[req.CustomID] = true
+		body.Requests = append(body.Requests, batchRequest{
+			CustomID: req.CustomID,
+			Params:   newRequest(req.Prompt, req.Options),
+		})
+	}
+
+	var batch Batch
+	if err := c.do(ctx, c.httpClient, "POST", c.baseURL+"/v1/messages/batches", body, &batch); err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// GetBatch returns the current state of a message batch
+func (c *Client) GetBatch(ctx context.Context, id string) (*Batch, error) {
+	var batch Batch
+	if err := c.do(ctx, c.httpClient, "GET", c.baseURL+"/v1/messages/batches/"+url.PathEscape(id), nil, &batch); err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// WaitBatch polls a message batch every interval until it has ended, which
+// can take up to a day, and returns its final state
+func (c *Client) WaitBatch(ctx context.Context, id string, interval time.Duration) (*Batch, error) {
+	for {
+		batch, err := c.GetBatch(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if batch.ProcessingStatus == BatchEnded {
+			return batch, nil
+		}
+		counts := batch.RequestCounts
+		log.Printf("Batch %s is %s: %d processing, %d succeeded, %d errored",
+			id, batch.ProcessingStatus, counts.Processing, counts.Succeeded, counts.Errored)
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// BatchResults streams the results of an ended batch to fn, one request at
+// a time in no particular order, and stops at the first error fn returns
+func (c *Client) BatchResults(ctx context.Context, batch *Batch, fn func(BatchResult) error) error {
+	if batch.ResultsURL == "" {
+		return fmt.Errorf("batch %s has no results yet", batch.ID)
+	}
+	resp, err := c.send(ctx, c.downloadClient, "GET", batch.ResultsURL, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	// A line holds a whole response, which can exceed the default limit
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var line batchResultLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return fmt.Errorf("error decoding batch result: %v", err)
+		}
+
+		result := BatchResult{CustomID: line.CustomID}
+		switch line.Result.Type {
+		case "succeeded":
+			result.Completion, result.Err = line.Result.Message.completion()
+		case "errored":
+			e := line.Result.Error.Error
+			result.Err = fmt.Errorf("Claude API error (%s): %s", e.Type, e.Message)
+		default:
+			result.Err = fmt.Errorf("batch request %s", line.Result.Type)
+		}
+		if err := fn(result); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading batch results: %v", err)
+	}
+	return nil
+}
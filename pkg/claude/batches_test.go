@@ -0,0 +1,143 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mrconter1/codeswitch-ai/pkg/claude/fake"
+)
+
+func batchRequests(prompts ...string) []BatchRequest {
+	var reqs []BatchRequest
+	for i, prompt := range prompts {
+		reqs = append(reqs, BatchRequest{CustomID: fmt.Sprintf("req-%d", i), Prompt: prompt})
+	}
+	return reqs
+}
+
+func TestCreateBatch(t *testing.T) {
+	server := fake.NewServer()
+	defer server.Close()
+	client := NewWithBaseURL("test", server.URL())
+	ctx := context.Background()
+
+	batch, err := client.CreateBatch(ctx, batchRequests("one", "two"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if batch.ID == "" || batch.ProcessingStatus != BatchInProgress || batch.RequestCounts.Processing != 2 {
+		t.Errorf("new batch = %+v, want an ID and 2 requests in progress", batch)
+	}
+
+	invalid := map[string][]BatchRequest{
+		"no requests":  nil,
+		"duplicate ID": {{CustomID: "a", Prompt: "one"}, {CustomID: "a", Prompt: "two"}},
+		"invalid ID":   {{CustomID: "paragraph 1", Prompt: "one"}},
+		"empty ID":     {{Prompt: "one"}},
+	}
+	for name, reqs := range invalid {
+		if _, err := client.CreateBatch(ctx, reqs); err == nil {
+			t.Errorf("%s: CreateBatch succeeded", name)
+		}
+	}
+}
+
+func TestWaitBatch(t *testing.T) {
+	server := fake.NewServer()
+	defer server.Close()
+	server.Polls = 2
+	client := NewWithBaseURL("test", server.URL())
+	ctx := context.Background()
+
+	batch, err := client.CreateBatch(ctx, batchRequests("one", "two", "three"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.BatchResults(ctx, batch, func(BatchResult) error { return nil }); err == nil {
+		t.Error("BatchResults of a batch in progress succeeded")
+	}
+
+	ended, err := client.WaitBatch(ctx, batch.ID, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ended.ProcessingStatus != BatchEnded || ended.ResultsURL == "" || ended.RequestCounts.Succeeded != 3 {
+		t.Errorf("ended batch = %+v, want 3 succeeded requests and results", ended)
+	}
+
+	if _, err := client.WaitBatch(ctx, "msgbatch_unknown", time.Millisecond); err == nil {
+		t.Error("WaitBatch of an unknown batch succeeded")
+	}
+}
+
+func TestWaitBatchCanceled(t *testing.T) {
+	server := fake.NewServer()
+	defer server.Close()
+	server.Polls = 1 << 20
+	client := NewWithBaseURL("test", server.URL())
+
+	batch, err := client.CreateBatch(context.Background(), batchRequests("one"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.WaitBatch(ctx, batch.ID, 10*time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("WaitBatch after the context ended = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestBatchResults(t *testing.T) {
+	server := fake.NewServer()
+	defer server.Close()
+	server.Polls = 0
+	server.Fail = func(prompt string) bool { return strings.Contains(prompt, "fail") }
+	client := NewWithBaseURL("test", server.URL())
+	ctx := context.Background()
+
+	batch, err := client.CreateBatch(ctx, batchRequests("one", "fail two", "three"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch, err = client.WaitBatch(ctx, batch.ID, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var order []string
+	results := make(map[string]BatchResult)
+	err = client.BatchResults(ctx, batch, func(result BatchResult) error {
+		order = append(order, result.CustomID)
+		results[result.CustomID] = result
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(order) != 3 || order[0] != "req-2" {
+		t.Errorf("results in order %v, want all 3 as the fake API writes them, last first", order)
+	}
+	for id, want := range map[string]string{"req-0": "one", "req-2": "three"} {
+		if c := results[id].Completion; results[id].Err != nil || c == nil || c.Text != want {
+			t.Errorf("result %s = %+v, want completion %q", id, results[id], want)
+		}
+	}
+	if failed := results["req-1"]; failed.Err == nil || failed.Completion != nil {
+		t.Errorf("result req-1 = %+v, want an error", failed)
+	}
+
+	// An error of fn stops the results
+	stop := errors.New("stop")
+	read := 0
+	err = client.BatchResults(ctx, batch, func(BatchResult) error {
+		read++
+		return stop
+	})
+	if !errors.Is(err, stop) || read != 1 {
+		t.Errorf("BatchResults read %d results and returned %v, want 1 and %v", read, err, stop)
+	}
+}
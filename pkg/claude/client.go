@@ -5,22 +5,45 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"strings"
 	"time"
 )
 
+// DefaultModel is used when a completion does not name a model. It supports
+// prompt caching.
+const DefaultModel = "claude-3-5-sonnet-20241022"
+
+// DefaultBaseURL is the address of the Anthropic API
+const DefaultBaseURL = "https://api.anthropic.com"
+
 type Client struct {
 	apiKey     string
 	httpClient *http.Client
-	endpoint   string
+	baseURL    string
+
+	// downloadClient has no timeout, for batch results of any size
+	downloadClient *http.Client
 }
 
 type request struct {
 	Model     string    `json:"model"`
 	MaxTokens int       `json:"max_tokens"`
+	System    []block   `json:"system,omitempty"`
 	Messages  []message `json:"messages"`
 }
 
+type block struct {
+	Type         string        `json:"type"`
+	Text         string        `json:"text"`
+	CacheControl *cacheControl `json:"cache_control,omitempty"`
+}
+
+type cacheControl struct {
+	Type string `json:"type"`
+}
+
 type message struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
@@ -30,20 +53,137 @@ type response struct {
 	Content []struct {
 		Text string `json:"text"`
 	} `json:"content"`
+	Model string `json:"model"`
+	Usage Usage  `json:"usage"`
+}
+
+// Options adjust a single completion
+type Options struct {
+	// Model defaults to DefaultModel and MaxTokens to 1024
+	Model     string
+	MaxTokens int
+	// System is the system prompt, sent apart from the user message
+	System []Block
+}
+
+// Block is a text block of the system prompt. Cache marks the end of a
+// prefix, every block up to and including this one, that the API keeps for
+// a few minutes and reuses for calls starting with the same prefix. Prefixes
+// shorter than MinCacheTokens are processed normally, without caching.
+type Block struct {
+	Text  string
+	Cache bool
+}
+
+// MinCacheTokens is the shortest prefix in tokens that model caches
+func MinCacheTokens(model string) int {
+	if model == "" {
+		model = DefaultModel
+	}
+	if strings.Contains(model, "haiku") {
+		return 2048
+	}
+	return 1024
+}
+
+// Cacheable reports whether blocks likely make a prefix long enough for
+// model to cache, estimating four characters per token, and returns the
+// estimate
+func Cacheable(model string, blocks []Block) (bool, int) {
+	chars := 0
+	for _, b := range blocks {
+		chars += len(b.Text)
+	}
+	tokens := chars / 4
+	return tokens >= MinCacheTokens(model), tokens
+}
+
+// Prefix returns system blocks for the non-empty texts in order, with the
+// last one marked for caching
+func Prefix(texts ...string) []Block {
+	var blocks []Block
+	for _, text := range texts {
+		if text != "" {
+			blocks = append(blocks, Block{Text: text})
+		}
+	}
+	if len(blocks) > 0 {
+		blocks[len(blocks)-1].Cache = true
+	}
+	return blocks
+}
+
+// Usage is the number of tokens a completion consumed. Input tokens read
+// from or written to the prompt cache are counted apart from InputTokens.
+type Usage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+// Add adds the tokens of other to u
+func (u *Usage) Add(other Usage) {
+	u.InputTokens += other.InputTokens
+	u.OutputTokens += other.OutputTokens
+	u.CacheCreationInputTokens += other.CacheCreationInputTokens
+	u.CacheReadInputTokens += other.CacheReadInputTokens
+}
+
+// Completion is the text of a response along with the model that produced
+// it and its token usage
+type Completion struct {
+	Text  string
+	Model string
+	Usage Usage
 }
 
 func New(apiKey string) *Client {
+	return NewWithBaseURL(apiKey, DefaultBaseURL)
+}
+
+// NewWithBaseURL creates a client for an API at another address, such as a
+// proxy or a local fake
+func NewWithBaseURL(apiKey, baseURL string) *Client {
 	return &Client{
 		apiKey:     apiKey,
 		httpClient: &http.Client{Timeout: 30 * time.Second},
-		endpoint:   "https://api.anthropic.com/v1/messages",
+		baseURL:    strings.TrimRight(baseURL, "/"),
+
+		downloadClient: &http.Client{},
 	}
 }
 
+// Complete sends prompt with the default options and returns the response text
 func (c *Client) Complete(ctx context.Context, prompt string) (string, error) {
+	completion, err := c.CompleteWith(ctx, prompt, Options{})
+	if err != nil {
+		return "", err
+	}
+	return completion.Text, nil
+}
+
+// CompleteWith sends prompt with the given options
+func (c *Client) CompleteWith(ctx context.Context, prompt string, opts Options) (*Completion, error) {
+	var result response
+	if err := c.do(ctx, c.httpClient, "POST", c.baseURL+"/v1/messages", newRequest(prompt, opts), &result); err != nil {
+		return nil, err
+	}
+	return result.completion()
+}
+
+// newRequest builds the request body of a completion, filling in the
+// default options
+func newRequest(prompt string, opts Options) request {
+	if opts.Model == "" {
+		opts.Model = DefaultModel
+	}
+	if opts.MaxTokens == 0 {
+		opts.MaxTokens = 1024
+	}
 	req := request{
-		Model:     "claude-3-sonnet-20240229",
-		MaxTokens: 1024,
+		Model:     opts.Model,
+		MaxTokens: opts.MaxTokens,
 		Messages: []message{
 			{
 				Role:    "user",
@@ -52,14 +192,45 @@ func (c *Client) Complete(ctx context.Context, prompt string) (string, error) {
 		},
 	}
 
-	body, err := json.Marshal(req)
-	if err != nil {
-		return "", fmt.Errorf("error marshaling request: %v", err)
+	for _, b := range opts.System {
+		sb := block{Type: "text", Text: b.Text}
+		if b.Cache {
+			sb.CacheControl = &cacheControl{Type: "ephemeral"}
+		}
+		req.System = append(req.System, sb)
+	}
+	return req
+}
+
+// completion returns the text of a response with its model and usage
+func (r *response) completion() (*Completion, error) {
+	if len(r.Content) == 0 {
+		return nil, fmt.Errorf("empty response from Claude")
+	}
+
+	return &Completion{
+		Text:  r.Content[0].Text,
+		Model: r.Model,
+		Usage: r.Usage,
+	}, nil
+}
+
+// send makes an API request with the required headers, failing on any
+// status but 200. body is sent as JSON unless it is nil; the caller closes
+// the response body.
+func (c *Client) send(ctx context.Context, httpClient *http.Client, method, url string, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling request: %v", err)
+		}
+		reader = bytes.NewBuffer(data)
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.endpoint, bytes.NewBuffer(body))
+	httpReq, err := http.NewRequestWithContext(ctx, method, url, reader)
 	if err != nil {
-		return "", fmt.Errorf("error creating request: %v", err)
+		return nil, fmt.Errorf("error creating request: %v", err)
 	}
 
 	// Set the required headers
@@ -67,28 +238,32 @@ func (c *Client) Complete(ctx context.Context, prompt string) (string, error) {
 	httpReq.Header.Set("anthropic-version", "2023-06-01")
 	httpReq.Header.Set("content-type", "application/json")
 
-	resp, err := c.httpClient.Do(httpReq)
+	resp, err := httpClient.Do(httpReq)
 	if err != nil {
-		return "", fmt.Errorf("error making request: %v", err)
+		return nil, fmt.Errorf("error making request: %v", err)
 	}
-	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
 		var errorBody map[string]interface{}
 		if err := json.NewDecoder(resp.Body).Decode(&errorBody); err != nil {
-			return "", fmt.Errorf("Claude API error (status %d): could not decode error body", resp.StatusCode)
+			return nil, fmt.Errorf("Claude API error (status %d): could not decode error body", resp.StatusCode)
 		}
-		return "", fmt.Errorf("Claude API error (status %d): %v", resp.StatusCode, errorBody)
+		return nil, fmt.Errorf("Claude API error (status %d): %v", resp.StatusCode, errorBody)
 	}
+	return resp, nil
+}
 
-	var result response
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", fmt.Errorf("error decoding response: %v", err)
+// do makes an API request and decodes the JSON response into out
+func (c *Client) do(ctx context.Context, httpClient *http.Client, method, url string, body, out interface{}) error {
+	resp, err := c.send(ctx, httpClient, method, url, body)
+	if err != nil {
+		return err
 	}
+	defer resp.Body.Close()
 
-	if len(result.Content) == 0 {
-		return "", fmt.Errorf("empty response from Claude")
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("error decoding response: %v", err)
 	}
-
-	return result.Content[0].Text, nil
+	return nil
 }
@@ -0,0 +1,21 @@
+package claude
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCacheable(t *testing.T) {
+	short := Prefix("You rewrite paragraphs.", "Switch the listed words.")
+	if ok, _ := Cacheable(DefaultModel, short); ok {
+		t.Error("short prefix is cacheable")
+	}
+
+	long := Prefix(strings.Repeat("word ", 1000))
+	if ok, tokens := Cacheable("", long); !ok {
+		t.Errorf("prefix of about %d tokens is not cacheable by the default model", tokens)
+	}
+	if ok, _ := Cacheable("claude-3-haiku-20240307", long); ok {
+		t.Error("prefix below the Haiku minimum is cacheable")
+	}
+}
@@ -0,0 +1,293 @@
+// Package fake serves the parts of the Anthropic API the claude package
+// uses, messages and message batches, from memory. It lets the pipeline run
+// end to end without an API key, for example in a batch job's dry run.
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Responder writes the answer to a prompt. system holds the text of the
+// system blocks.
+type Responder func(prompt string, system []string) string
+
+// paragraph matches the delimited paragraph of a code-switching prompt
+var paragraph = regexp.MustCompile(`(?s)<paragraph-[0-9a-f]+>\n(.*?)\n</paragraph-[0-9a-f]+>`)
+
+// Echo answers with the paragraph of the prompt unchanged, which passes the
+// output checks, or with the whole prompt when it has no paragraph
+func Echo(prompt string, system []string) string {
+	if m := paragraph.FindStringSubmatch(prompt); m != nil {
+		return m[1]
+	}
+	return prompt
+}
+
+// Server is a fake API on a local port
+type Server struct {
+	// Respond answers prompts, Echo by default
+	Respond Responder
+	// Polls is how many times a batch is reported in progress before it
+	// ends
+	Polls int
+	// Fail, when set, makes the requests it returns true for fail: single
+	// messages with a server error and batch requests as errored
+	Fail func(prompt string) bool
+	// RejectBatch, when set, makes creating the batches it returns true
+	// for fail with a server error, given their custom IDs
+	RejectBatch func(customIDs []string) bool
+
+	server  *httptest.Server
+	mu      sync.Mutex
+	batches map[string]*batch
+	created int
+}
+
+type batch struct {
+	id       string
+	created  time.Time
+	polls    int
+	requests []batchRequest
+}
+
+type message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type params struct {
+	Model     string `json:"model"`
+	MaxTokens int    `json:"max_tokens"`
+	System    []struct {
+		Text string `json:"text"`
+	} `json:"system"`
+	Messages []message `json:"messages"`
+}
+
+type batchRequest struct {
+	CustomID string `json:"custom_id"`
+	Params   params `json:"params"`
+}
+
+// NewServer starts a fake API. Point a client at it with
+// claude.NewWithBaseURL(key, server.URL()) and Close it when done.
+func NewServer() *Server {
+	s := &Server{
+		Respond: Echo,
+		Polls:   1,
+		batches: make(map[string]*batch),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/messages", s.handleMessage)
+	mux.HandleFunc("/v1/messages/batches", s.handleCreateBatch)
+	mux.HandleFunc("/v1/messages/batches/", s.handleBatch)
+	s.server = httptest.NewServer(s.authorized(mux))
+	return s
+}
+
+// URL is the base URL of the fake API
+func (s *Server) URL() string {
+	return s.server.URL
+}
+
+// Close shuts the fake API down
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// authorized rejects requests without the headers the real API requires
+func (s *Server) authorized(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-api-key") == "" || r.Header.Get("anthropic-version") == "" {
+			writeError(w, http.StatusUnauthorized, "authentication_error", "x-api-key and anthropic-version are required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleMessage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "invalid_request_error", "method not allowed")
+		return
+	}
+	var p params
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil || len(p.Messages) == 0 {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "invalid message request")
+		return
+	}
+	if s.Fail != nil && s.Fail(p.Messages[len(p.Messages)-1].Content) {
+		writeError(w, http.StatusInternalServerError, "api_error", "fake failure")
+		return
+	}
+	writeJSON(w, s.answer(p))
+}
+
+func (s *Server) handleCreateBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "invalid_request_error", "method not allowed")
+		return
+	}
+	var body struct {
+		Requests []batchRequest `json:"requests"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || len(body.Requests) == 0 {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "invalid batch request")
+		return
+	}
+	if s.RejectBatch != nil {
+		ids := make([]string, len(body.Requests))
+		for i, req := range body.Requests {
+			ids[i] = req.CustomID
+		}
+		if s.RejectBatch(ids) {
+			writeError(w, http.StatusInternalServerError, "api_error", "fake failure")
+			return
+		}
+	}
+
+	s.mu.Lock()
+	s.created++
+	b := &batch{
+		id:       fmt.Sprintf("msgbatch_fake%d", s.created),
+		created:  time.Now().UTC(),
+		requests: body.Requests,
+	}
+	s.batches[b.id] = b
+	s.mu.Unlock()
+
+	writeJSON(w, s.state(b, false))
+}
+
+// handleBatch serves the state of a batch and, once it has ended, its
+// results
+func (s *Server) handleBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "invalid_request_error", "method not allowed")
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/v1/messages/batches/")
+	id, results := strings.CutSuffix(id, "/results")
+
+	s.mu.Lock()
+	b, ok := s.batches[id]
+	ended := false
+	if ok && !results {
+		b.polls++
+	}
+	if ok {
+		ended = b.polls > s.Polls
+	}
+	s.mu.Unlock()
+
+	switch {
+	case !ok:
+		writeError(w, http.StatusNotFound, "not_found_error", "no batch "+id)
+	case results && !ended:
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "batch "+id+" is still in progress")
+	case results:
+		s.writeResults(w, b)
+	default:
+		writeJSON(w, s.state(b, ended))
+	}
+}
+
+// writeResults writes one JSONL line per request, last request first, as
+// the API does not keep the order of the batch
+func (s *Server) writeResults(w http.ResponseWriter, b *batch) {
+	w.Header().Set("Content-Type", "application/binary")
+	encoder := json.NewEncoder(w)
+	for i := len(b.requests) - 1; i >= 0; i-- {
+		req := b.requests[i]
+		line := map[string]interface{}{"custom_id": req.CustomID}
+		if s.failed(req.Params) {
+			line["result"] = map[string]interface{}{
+				"type": "errored",
+				"error": map[string]interface{}{
+					"type":  "error",
+					"error": map[string]string{"type": "api_error", "message": "fake failure"},
+				},
+			}
+		} else {
+			line["result"] = map[string]interface{}{"type": "succeeded", "message": s.answer(req.Params)}
+		}
+		encoder.Encode(line)
+	}
+}
+
+func (s *Server) failed(p params) bool {
+	return s.Fail != nil && len(p.Messages) > 0 && s.Fail(p.Messages[len(p.Messages)-1].Content)
+}
+
+// state is the message batch object of b
+func (s *Server) state(b *batch, ended bool) map[string]interface{} {
+	counts := map[string]int{"processing": len(b.requests), "succeeded": 0, "errored": 0, "canceled": 0, "expired": 0}
+	state := map[string]interface{}{
+		"id":                b.id,
+		"type":              "message_batch",
+		"processing_status": "in_progress",
+		"created_at":        b.created,
+		"expires_at":        b.created.Add(24 * time.Hour),
+		"ended_at":          nil,
+		"results_url":       nil,
+		"request_counts":    counts,
+	}
+	if ended {
+		counts["processing"] = 0
+		for _, req := range b.requests {
+			if s.failed(req.Params) {
+				counts["errored"]++
+			} else {
+				counts["succeeded"]++
+			}
+		}
+		state["processing_status"] = "ended"
+		state["ended_at"] = b.created
+		state["results_url"] = s.server.URL + "/v1/messages/batches/" + b.id + "/results"
+	}
+	return state
+}
+
+// answer is the message object responding to p
+func (s *Server) answer(p params) map[string]interface{} {
+	var system []string
+	for _, block := range p.System {
+		system = append(system, block.Text)
+	}
+	prompt := p.Messages[len(p.Messages)-1].Content
+	text := s.Respond(prompt, system)
+
+	return map[string]interface{}{
+		"id":          "msg_fake",
+		"type":        "message",
+		"role":        "assistant",
+		"model":       p.Model,
+		"content":     []map[string]string{{"type": "text", "text": text}},
+		"stop_reason": "end_turn",
+		"usage": map[string]int{
+			"input_tokens":  (len(prompt) + len(strings.Join(system, ""))) / 4,
+			"output_tokens": len(text) / 4,
+		},
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, kind, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"type":  "error",
+		"error": map[string]string{"type": kind, "message": message},
+	})
+}
@@ -0,0 +1,134 @@
+package lemma
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Lemmatizer maps an inflected word to candidate base forms
+type Lemmatizer interface {
+	// Lemmas returns candidate lemmas of a lowercase word, most likely first.
+	// The word itself is not included.
+	Lemmas(word string) []string
+	// Known returns the candidates that are certain, those listed as
+	// irregular forms rather than guessed by stripping a suffix, which can
+	// turn a word into another one ("only" into "on")
+	Known(word string) []string
+}
+
+// Table looks words up in a list of irregular forms
+type Table map[string]string
+
+func (t Table) Lemmas(word string) []string {
+	if lemma, ok := t[word]; ok && lemma != word {
+		return []string{lemma}
+	}
+	return nil
+}
+
+func (t Table) Known(word string) []string {
+	return t.Lemmas(word)
+}
+
+// Rule replaces a suffix of a word, as in "ies" → "y"
+type Rule struct {
+	Suffix      string
+	Replacement string
+}
+
+// Rules strips inflectional suffixes. Longer suffixes are tried first and
+// every rule that applies contributes a candidate.
+type Rules []Rule
+
+// minStem is the shortest stem a rule may leave behind
+const minStem = 2
+
+func (r Rules) Lemmas(word string) []string {
+	var lemmas []string
+	for _, rule := range r {
+		if !strings.HasSuffix(word, rule.Suffix) || len(word)-len(rule.Suffix) < minStem {
+			continue
+		}
+		lemma := word[:len(word)-len(rule.Suffix)] + rule.Replacement
+		if lemma != word {
+			lemmas = append(lemmas, lemma)
+		}
+	}
+	return lemmas
+}
+
+// Known returns nothing, as suffix rules only guess
+func (r Rules) Known(word string) []string {
+	return nil
+}
+
+// Chain combines lemmatizers, keeping the order of their candidates
+type Chain []Lemmatizer
+
+func (c Chain) Lemmas(word string) []string {
+	return c.collect(word, Lemmatizer.Lemmas)
+}
+
+func (c Chain) Known(word string) []string {
+	return c.collect(word, Lemmatizer.Known)
+}
+
+// collect gathers the distinct candidates of every lemmatizer in order
+func (c Chain) collect(word string, candidates func(Lemmatizer, string) []string) []string {
+	var lemmas []string
+	seen := make(map[string]bool)
+	for _, l := range c {
+		for _, lemma := range candidates(l, word) {
+			if !seen[lemma] {
+				seen[lemma] = true
+				lemmas = append(lemmas, lemma)
+			}
+		}
+	}
+	return lemmas
+}
+
+// ParseTable reads "form<TAB>lemma" lines. Blank lines and lines starting
+// with # are ignored.
+func ParseTable(r io.Reader) (Table, error) {
+	table := make(Table)
+	err := readPairs(r, func(form, lemma string) {
+		table[strings.ToLower(form)] = strings.ToLower(lemma)
+	})
+	return table, err
+}
+
+// ParseRules reads "suffix<TAB>replacement" lines, where the replacement
+// may be "-" for none, and orders them longest suffix first
+func ParseRules(r io.Reader) (Rules, error) {
+	var rules Rules
+	err := readPairs(r, func(suffix, replacement string) {
+		if replacement == "-" {
+			replacement = ""
+		}
+		rules = append(rules, Rule{Suffix: suffix, Replacement: replacement})
+	})
+	sort.SliceStable(rules, func(i, j int) bool {
+		return len(rules[i].Suffix) > len(rules[j].Suffix)
+	})
+	return rules, err
+}
+
+func readPairs(r io.Reader, add func(string, string)) error {
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		parts := strings.Fields(text)
+		if len(parts) != 2 {
+			return fmt.Errorf("line %d: expected two fields, got %q", line, text)
+		}
+		add(parts[0], parts[1])
+	}
+	return scanner.Err()
+}
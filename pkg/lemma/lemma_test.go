@@ -0,0 +1,54 @@
+package lemma
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestChainKnown(t *testing.T) {
+	l := NewRegistry("").Get("en")
+	if l == nil {
+		t.Fatal("no English lemmatizer")
+	}
+
+	if got := l.Known("went"); !slices.Equal(got, []string{"go"}) {
+		t.Errorf(`Known("went") = %q, want ["go"]`, got)
+	}
+	// Suffix rules guess, they do not know
+	if got := l.Known("only"); len(got) != 0 {
+		t.Errorf(`Known("only") = %q, want none`, got)
+	}
+	if got := l.Lemmas("only"); !slices.Contains(got, "on") {
+		t.Errorf(`Lemmas("only") = %q, want the guess "on"`, got)
+	}
+}
+
+func TestRegistryRetriesFailedLoads(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "xx.table.tsv")
+	if err := os.WriteFile(path, []byte("broken\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewRegistry(dir)
+	if l := r.Get("xx"); l != nil {
+		t.Fatalf("Get with a broken table = %v, want nil", l)
+	}
+	if err := os.WriteFile(path, []byte("mice\tmouse\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	l := r.Get("xx")
+	if l == nil {
+		t.Fatal("failed load was remembered")
+	}
+	if got := l.Lemmas("mice"); !slices.Equal(got, []string{"mouse"}) {
+		t.Errorf(`Lemmas("mice") = %q, want ["mouse"]`, got)
+	}
+
+	// Languages without data stay without
+	if r.Get("zz") != nil || r.Get("zz") != nil {
+		t.Error("Get without data returned a lemmatizer")
+	}
+}
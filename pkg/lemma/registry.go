@@ -0,0 +1,100 @@
+package lemma
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"sync"
+)
+
+// bundled holds the default data files: <lang>.table.tsv with irregular
+// forms and <lang>.rules.tsv with suffix rules
+//
+//go:embed data
+var bundled embed.FS
+
+// Registry loads lemmatizers per language from a data directory, falling back
+// to the bundled data files
+type Registry struct {
+	dir string
+
+	mu          sync.Mutex
+	lemmatizers map[string]Lemmatizer
+}
+
+// NewRegistry creates a registry; dir may be empty to only use bundled data
+func NewRegistry(dir string) *Registry {
+	return &Registry{
+		dir:         dir,
+		lemmatizers: make(map[string]Lemmatizer),
+	}
+}
+
+// Get returns the lemmatizer of a language, or nil when there is no data for
+// it. Languages without data are matched on surface forms only. Failed loads
+// are not remembered, so the next request retries.
+func (r *Registry) Get(lang string) Lemmatizer {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if l, ok := r.lemmatizers[lang]; ok {
+		return l
+	}
+
+	l, err := r.load(lang)
+	if err != nil {
+		log.Printf("Error loading lemmatizer for %s: %v", lang, err)
+		return nil
+	}
+	r.lemmatizers[lang] = l
+	return l
+}
+
+func (r *Registry) load(lang string) (Lemmatizer, error) {
+	var chain Chain
+
+	table, err := r.open(lang + ".table.tsv")
+	if err == nil {
+		parsed, err := ParseTable(table)
+		table.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s.table.tsv: %v", lang, err)
+		}
+		chain = append(chain, parsed)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	rules, err := r.open(lang + ".rules.tsv")
+	if err == nil {
+		parsed, err := ParseRules(rules)
+		rules.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s.rules.tsv: %v", lang, err)
+		}
+		chain = append(chain, parsed)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	if len(chain) == 0 {
+		return nil, nil
+	}
+	log.Printf("Loaded lemmatizer for %s", lang)
+	return chain, nil
+}
+
+// open reads a data file from the configured directory, or from the bundled
+// files when the directory does not have it
+func (r *Registry) open(name string) (fs.File, error) {
+	if r.dir != "" {
+		f, err := os.DirFS(r.dir).Open(name)
+		if !errors.Is(err, fs.ErrNotExist) {
+			return f, err
+		}
+	}
+	return bundled.Open("data/" + name)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
@@ -20,6 +21,12 @@ type ParagraphTask struct {
 	Words      []string `json:"words"`
 	SourceLang string   `json:"sourceLang"`
 	TargetLang string   `json:"targetLang"`
+	// Percentage is the requested share of switched words, against which
+	// the model's output is checked
+	Percentage float64 `json:"percentage,omitempty"`
+
+	// PromptVersion identifies the prompt templates a result was made with
+	PromptVersion string `json:"promptVersion,omitempty"`
 }
 
 func NewRabbitMQ(url string) (*RabbitMQ, error) {
@@ -104,6 +111,58 @@ func (r *RabbitMQ) ConsumeParagraphs(ctx context.Context) (<-chan ParagraphTask,
 	return tasks, nil
 }
 
+// ConsumeParagraphBatches groups consumed tasks into batches of up to size
+// tasks. A batch is handed out when it is full or when no further task
+// arrived for wait.
+func (r *RabbitMQ) ConsumeParagraphBatches(ctx context.Context, size int, wait time.Duration) (<-chan []ParagraphTask, error) {
+	tasks, err := r.ConsumeParagraphs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	batches := make(chan []ParagraphTask)
+	go func() {
+		defer close(batches)
+		var batch []ParagraphTask
+		send := func() bool {
+			select {
+			case batches <- batch:
+				batch = nil
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		for {
+			var timeout <-chan time.Time
+			if len(batch) > 0 {
+				timeout = time.After(wait)
+			}
+			select {
+			case task, ok := <-tasks:
+				if !ok {
+					if len(batch) > 0 {
+						send()
+					}
+					return
+				}
+				batch = append(batch, task)
+				if len(batch) >= size && !send() {
+					return
+				}
+			case <-timeout:
+				if !send() {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return batches, nil
+}
+
 func (r *RabbitMQ) Close() error {
 	if err := r.channel.Close(); err != nil {
 		return fmt.Errorf("failed to close channel: %v", err)
@@ -0,0 +1,174 @@
+package pos
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/mrconter1/codeswitch-ai/pkg/lemma"
+)
+
+// Tag is a coarse part of speech, named after the Universal Dependencies tags
+type Tag string
+
+const (
+	Noun Tag = "noun"
+	Verb Tag = "verb"
+	Adj  Tag = "adj"
+	Adv  Tag = "adv"
+	Pron Tag = "pron"
+	Det  Tag = "det"
+	Adp  Tag = "adp"
+	Conj Tag = "conj"
+	Num  Tag = "num"
+	Part Tag = "part"
+)
+
+var tags = map[Tag]bool{
+	Noun: true, Verb: true, Adj: true, Adv: true, Pron: true,
+	Det: true, Adp: true, Conj: true, Num: true, Part: true,
+}
+
+// ParseTag parses a tag name such as "noun", ignoring case
+func ParseTag(name string) (Tag, error) {
+	tag := Tag(strings.ToLower(strings.TrimSpace(name)))
+	if !tags[tag] {
+		return "", fmt.Errorf("unknown part of speech %q", name)
+	}
+	return tag, nil
+}
+
+// suffix assigns a tag to unknown words ending in it
+type suffix struct {
+	text string
+	tag  Tag
+}
+
+// Tagger assigns parts of speech from a lexicon of known words, suffix rules
+// for unknown words and the tag of the preceding word. Words listed with
+// several tags ("run" as verb or noun) are resolved by that context.
+type Tagger struct {
+	lexicon  map[string][]Tag
+	suffixes []suffix
+}
+
+// Tag returns the part of speech of each lowercase word. A lemmatizer, when
+// given, lets inflected forms of lexicon words be found.
+func (t *Tagger) Tag(words []string, lemmatizer lemma.Lemmatizer) []Tag {
+	result := make([]Tag, len(words))
+	var previous Tag
+	for i, word := range words {
+		candidates := t.lookup(word, lemmatizer)
+		result[i] = resolve(candidates, previous)
+		previous = result[i]
+	}
+	return result
+}
+
+// lookup returns the possible tags of a word, most likely first
+func (t *Tagger) lookup(word string, lemmatizer lemma.Lemmatizer) []Tag {
+	if candidates, ok := t.lexicon[word]; ok {
+		return candidates
+	}
+	if lemmatizer != nil {
+		for _, l := range lemmatizer.Lemmas(word) {
+			if candidates, ok := t.lexicon[l]; ok {
+				return candidates
+			}
+		}
+	}
+	for _, s := range t.suffixes {
+		if strings.HasSuffix(word, s.text) && len(word) > len(s.text)+1 {
+			return []Tag{s.tag}
+		}
+	}
+	return nil
+}
+
+// resolve picks a tag from the candidates given the previous word's tag.
+// Determiners, adjectives and prepositions are followed by nouns; pronouns
+// and particles such as "to" by verbs.
+func resolve(candidates []Tag, previous Tag) Tag {
+	var expected Tag
+	switch previous {
+	case Det, Adj, Adp:
+		expected = Noun
+	case Pron, Part:
+		expected = Verb
+	}
+
+	if len(candidates) == 0 {
+		if expected != "" {
+			return expected
+		}
+		return Noun
+	}
+	for _, c := range candidates {
+		if c == expected {
+			return c
+		}
+	}
+	return candidates[0]
+}
+
+// Parse reads a tagger from a lexicon of "word<TAB>tag[,tag...]" lines and
+// suffix rules of "suffix<TAB>tag" lines. Blank lines and lines starting with
+// # are ignored; suffix rules are tried longest first.
+func Parse(lexicon, suffixes io.Reader) (*Tagger, error) {
+	t := &Tagger{lexicon: make(map[string][]Tag)}
+
+	if lexicon != nil {
+		err := readPairs(lexicon, func(word, names string) error {
+			for _, name := range strings.Split(names, ",") {
+				tag, err := ParseTag(name)
+				if err != nil {
+					return err
+				}
+				t.lexicon[strings.ToLower(word)] = append(t.lexicon[strings.ToLower(word)], tag)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("lexicon: %v", err)
+		}
+	}
+
+	if suffixes != nil {
+		err := readPairs(suffixes, func(text, name string) error {
+			tag, err := ParseTag(name)
+			if err != nil {
+				return err
+			}
+			t.suffixes = append(t.suffixes, suffix{text: text, tag: tag})
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("suffixes: %v", err)
+		}
+		sort.SliceStable(t.suffixes, func(i, j int) bool {
+			return len(t.suffixes[i].text) > len(t.suffixes[j].text)
+		})
+	}
+
+	return t, nil
+}
+
+func readPairs(r io.Reader, add func(string, string) error) error {
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		parts := strings.Fields(text)
+		if len(parts) != 2 {
+			return fmt.Errorf("line %d: expected two fields, got %q", line, text)
+		}
+		if err := add(parts[0], parts[1]); err != nil {
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,90 @@
+package pos
+
+import (
+	"embed"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"sync"
+)
+
+// bundled holds the default data files: <lang>.lexicon.tsv with known words
+// and <lang>.suffixes.tsv with suffix rules
+//
+//go:embed data
+var bundled embed.FS
+
+// Registry loads taggers per language from a data directory, falling back to
+// the bundled data files
+type Registry struct {
+	dir string
+
+	mu      sync.Mutex
+	taggers map[string]*Tagger
+}
+
+// NewRegistry creates a registry; dir may be empty to only use bundled data
+func NewRegistry(dir string) *Registry {
+	return &Registry{
+		dir:     dir,
+		taggers: make(map[string]*Tagger),
+	}
+}
+
+// Get returns the tagger of a language, or nil when there is no data for it.
+// Failed loads are not remembered, so the next request retries.
+func (r *Registry) Get(lang string) *Tagger {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if t, ok := r.taggers[lang]; ok {
+		return t
+	}
+
+	t, err := r.load(lang)
+	if err != nil {
+		log.Printf("Error loading tagger for %s: %v", lang, err)
+		return nil
+	}
+	r.taggers[lang] = t
+	return t
+}
+
+func (r *Registry) load(lang string) (*Tagger, error) {
+	var readers [2]io.Reader
+	for i, name := range []string{lang + ".lexicon.tsv", lang + ".suffixes.tsv"} {
+		f, err := r.open(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		readers[i] = f
+	}
+	if readers[0] == nil && readers[1] == nil {
+		return nil, nil
+	}
+
+	t, err := Parse(readers[0], readers[1])
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Loaded part-of-speech tagger for %s", lang)
+	return t, nil
+}
+
+// open reads a data file from the configured directory, or from the bundled
+// files when the directory does not have it
+func (r *Registry) open(name string) (fs.File, error) {
+	if r.dir != "" {
+		f, err := os.DirFS(r.dir).Open(name)
+		if !errors.Is(err, fs.ErrNotExist) {
+			return f, err
+		}
+	}
+	return bundled.Open("data/" + name)
+}
@@ -0,0 +1,35 @@
+package pos
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRegistryRetriesFailedLoads(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "xx.lexicon.tsv")
+	if err := os.WriteFile(path, []byte("house\tthing\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewRegistry(dir)
+	if tagger := r.Get("xx"); tagger != nil {
+		t.Fatal("Get with a broken lexicon returned a tagger")
+	}
+	if err := os.WriteFile(path, []byte("house\tnoun\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tagger := r.Get("xx")
+	if tagger == nil {
+		t.Fatal("failed load was remembered")
+	}
+	if got := tagger.Tag([]string{"house"}, nil); len(got) != 1 || got[0] != Noun {
+		t.Errorf(`Tag("house") = %v, want [noun]`, got)
+	}
+
+	// Languages without data stay without
+	if r.Get("zz") != nil || r.Get("zz") != nil {
+		t.Error("Get without data returned a tagger")
+	}
+}
@@ -0,0 +1,116 @@
+package tokenizer
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// unspacedScripts are scripts written without spaces between words
+var unspacedScripts = []*unicode.RangeTable{
+	unicode.Han, unicode.Hiragana, unicode.Katakana,
+	unicode.Thai, unicode.Lao, unicode.Khmer, unicode.Myanmar,
+}
+
+// Lexicon is the vocabulary used to find word boundaries in unspaced text
+type Lexicon interface {
+	// Contains reports whether word (in normalized form) is a known word
+	Contains(word string) bool
+	// MaxWordLen returns the length in runes of the longest known word
+	MaxWordLen() int
+}
+
+// IsUnspaced reports whether a word token is written in a script that does
+// not separate words with spaces
+func IsUnspaced(t Token) bool {
+	if t.Kind != Word {
+		return false
+	}
+	r, _ := utf8.DecodeRuneInString(t.Text)
+	return unicode.In(r, unspacedScripts...)
+}
+
+// Segment splits text into word tokens like Words, but additionally breaks
+// runs of unspaced scripts (Chinese, Japanese, Thai, ...) into words by
+// forward longest match against the lexicon. Characters not starting any
+// known word become single-character words.
+func Segment(text string, lexicon Lexicon) []Token {
+	var words []Token
+	for _, t := range Tokenize(text) {
+		if t.Kind != Word {
+			continue
+		}
+		if !containsUnspaced(t.Text) {
+			words = append(words, t)
+			continue
+		}
+		words = append(words, longestMatch(t, lexicon)...)
+	}
+	return words
+}
+
+// Characters splits an unspaced word token into one token per character,
+// the finest segmentation possible without a lexicon
+func Characters(t Token) []Token {
+	var chars []Token
+	for i, r := range t.Text {
+		size := utf8.RuneLen(r)
+		chars = append(chars, Token{
+			Text:  t.Text[i : i+size],
+			Start: t.Start + i,
+			End:   t.Start + i + size,
+			Kind:  Word,
+		})
+	}
+	return chars
+}
+
+func containsUnspaced(s string) bool {
+	for _, r := range s {
+		if unicode.In(r, unspacedScripts...) {
+			return true
+		}
+	}
+	return false
+}
+
+func longestMatch(t Token, lexicon Lexicon) []Token {
+	maxLen := max(lexicon.MaxWordLen(), 1)
+
+	// offsets[i] is the byte offset of rune i within the token
+	var offsets []int
+	for i := range t.Text {
+		offsets = append(offsets, i)
+	}
+	offsets = append(offsets, len(t.Text))
+	runes := len(offsets) - 1
+
+	unspaced := func(i int) bool {
+		r, _ := utf8.DecodeRuneInString(t.Text[offsets[i]:])
+		return unicode.In(r, unspacedScripts...)
+	}
+
+	var words []Token
+	for i := 0; i < runes; {
+		length := 1
+		if !unspaced(i) {
+			// Spaced script letters attached to the run form their own word
+			for i+length < runes && !unspaced(i+length) {
+				length++
+			}
+		}
+		for n := min(maxLen, runes-i); n > length && unspaced(i); n-- {
+			if lexicon.Contains(Normalize(t.Text[offsets[i]:offsets[i+n]])) {
+				length = n
+				break
+			}
+		}
+		words = append(words, Token{
+			Text:  t.Text[offsets[i]:offsets[i+length]],
+			Start: t.Start + offsets[i],
+			End:   t.Start + offsets[i+length],
+			Kind:  Word,
+		})
+		i += length
+	}
+	return words
+}
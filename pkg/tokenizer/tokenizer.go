@@ -0,0 +1,158 @@
+package tokenizer
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Kind classifies a token
+type Kind int
+
+const (
+	Word Kind = iota
+	Number
+	Punct
+	Space
+)
+
+// Token is a span of the input text. Start and End are byte offsets, so
+// text[Start:End] == Text.
+type Token struct {
+	Text  string
+	Start int
+	End   int
+	Kind  Kind
+}
+
+// Normalized returns the lowercase form of a word with typographic
+// apostrophes replaced by ASCII ones, as used in frequency lists
+func (t Token) Normalized() string {
+	return Normalize(t.Text)
+}
+
+// Variants returns the forms to look a word up by, most specific first: the
+// normalized word and, for possessives and clitics ("dog's", "we'll"), the
+// part before the apostrophe
+func (t Token) Variants() []string {
+	word := t.Normalized()
+	variants := []string{word}
+	if i := strings.IndexByte(word, '\''); i > 0 {
+		variants = append(variants, word[:i])
+	}
+	return variants
+}
+
+// IsWord reports whether the token is a word
+func (t Token) IsWord() bool {
+	return t.Kind == Word
+}
+
+// apostrophes maps typographic apostrophes to the ASCII one
+var apostrophes = strings.NewReplacer("’", "'", "ʼ", "'")
+
+// Normalize lowercases s and replaces typographic apostrophes
+func Normalize(s string) string {
+	return strings.ToLower(apostrophes.Replace(s))
+}
+
+// Tokenize splits text into words, numbers, punctuation and whitespace.
+// Words follow Unicode letters and marks; an apostrophe between letters
+// ("don't", "o'clock") and a hyphen between letters ("well-known") stay inside
+// the word. Every rune of text belongs to exactly one token.
+func Tokenize(text string) []Token {
+	var tokens []Token
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		start := i
+		kind := Punct
+
+		switch {
+		case isLetter(r):
+			kind = Word
+			i = scanWord(text, i)
+		case unicode.IsDigit(r):
+			kind = Number
+			i = scanNumber(text, i)
+		case unicode.IsSpace(r):
+			kind = Space
+			for i < len(text) {
+				r, size := utf8.DecodeRuneInString(text[i:])
+				if !unicode.IsSpace(r) {
+					break
+				}
+				i += size
+			}
+		default:
+			i += size
+		}
+
+		tokens = append(tokens, Token{Text: text[start:i], Start: start, End: i, Kind: kind})
+	}
+	return tokens
+}
+
+// Words returns only the word tokens of text
+func Words(text string) []Token {
+	var words []Token
+	for _, t := range Tokenize(text) {
+		if t.Kind == Word {
+			words = append(words, t)
+		}
+	}
+	return words
+}
+
+func isLetter(r rune) bool {
+	return unicode.IsLetter(r) || unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Mc, r)
+}
+
+func isJoiner(r rune) bool {
+	switch r {
+	case '\'', '’', 'ʼ', '-', '‐':
+		return true
+	}
+	return false
+}
+
+// scanWord returns the end of the word starting at i. Letters and digits
+// continue a word; apostrophes and hyphens only when a letter follows.
+func scanWord(text string, i int) int {
+	for i < len(text) {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if isLetter(r) || unicode.IsDigit(r) {
+			i += size
+			continue
+		}
+		if isJoiner(r) && i+size < len(text) {
+			next, _ := utf8.DecodeRuneInString(text[i+size:])
+			if isLetter(next) {
+				i += size
+				continue
+			}
+		}
+		break
+	}
+	return i
+}
+
+// scanNumber returns the end of the number starting at i, keeping decimal
+// and thousands separators that sit between digits ("1,000.5")
+func scanNumber(text string, i int) int {
+	for i < len(text) {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if unicode.IsDigit(r) {
+			i += size
+			continue
+		}
+		if (r == '.' || r == ',') && i+size < len(text) {
+			next, _ := utf8.DecodeRuneInString(text[i+size:])
+			if unicode.IsDigit(next) {
+				i += size
+				continue
+			}
+		}
+		break
+	}
+	return i
+}